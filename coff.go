@@ -10,8 +10,8 @@ import (
 // https://docs.microsoft.com/en-us/windows/win32/debug/pe-format#other-contents-of-the-file
 
 const (
-	_IMAGE_SCN_MEM_READ             = 0x00000040
-	_IMAGE_SCN_CNT_INITIALIZED_DATA = 0x40000000
+	_IMAGE_SCN_MEM_READ             = 0x40000000
+	_IMAGE_SCN_CNT_INITIALIZED_DATA = 0x00000040
 )
 
 const sizeOfReloc = 10
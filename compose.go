@@ -0,0 +1,118 @@
+package winres
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// IconLayer is a layer of an icon made by ComposeIcon.
+type IconLayer struct {
+	Image image.Image
+	// Scale is the size of the layer relative to the size of the icon, 0 meaning 1.
+	// The image is resized to fit in a square of that size, keeping its aspect ratio.
+	Scale float64
+	// Anchor is the position of the layer in the icon.
+	Anchor anchor
+	// MinSize is the smallest icon size that shows this layer, so a badge can be hidden from tiny icons.
+	MinSize int
+}
+
+type anchor int
+
+// Positions of a layer in an icon
+const (
+	AnchorCenter anchor = iota
+	AnchorTopLeft
+	AnchorTop
+	AnchorTopRight
+	AnchorLeft
+	AnchorRight
+	AnchorBottomLeft
+	AnchorBottom
+	AnchorBottomRight
+)
+
+// ComposeIcon makes an icon by drawing layers on top of each other, at each size.
+//
+// The first layer is the background. Each layer is resized separately, which keeps small overlays sharp.
+// This is useful to make variants of an icon, such as a "beta" badge over the main artwork.
+//
+// If sizes is nil, the icon will be made in sizes: 256px, 64px, 48px, 32px, 16px.
+//
+// It accepts the same options as NewIconFromResizedImage.
+func ComposeIcon(layers []IconLayer, sizes []int, opt ...iconOption) (*Icon, error) {
+	if sizes == nil {
+		sizes = DefaultIconSizes
+	}
+	if len(sizes) > 30 {
+		return nil, errors.New(errTooManyIconSizes)
+	}
+	for _, l := range layers {
+		if l.Image == nil || l.Image.Bounds().Empty() || l.Scale < 0 {
+			return nil, errors.New(errInvalidImageDimensions)
+		}
+	}
+
+	icon := Icon{}
+	options := makeIconOptions(opt)
+	for _, s := range sizes {
+		if s < 1 || s > 256 {
+			return nil, errors.New(errInvalidImageDimensions)
+		}
+		if err := icon.addImage(composeLayers(layers, s, &options), &options); err != nil {
+			return nil, err
+		}
+	}
+
+	return &icon, nil
+}
+
+func composeLayers(layers []IconLayer, size int, options *iconOptions) image.Image {
+	canvas := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for _, l := range layers {
+		if size < l.MinSize {
+			continue
+		}
+		scale := l.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		layerSize := int(math.Round(float64(size) * scale))
+		if layerSize < 1 {
+			continue
+		}
+
+		img := resizeImage(l.Image, layerSize, options)
+		b := img.Bounds()
+		draw.Draw(canvas, b.Sub(b.Min).Add(l.Anchor.position(b.Size(), size)), img, b.Min, draw.Over)
+	}
+
+	return canvas
+}
+
+// position returns the top left corner of a layer of a given size, anchored in a square.
+func (a anchor) position(layer image.Point, size int) image.Point {
+	var (
+		p    = image.Point{X: (size - layer.X) / 2, Y: (size - layer.Y) / 2}
+		maxX = size - layer.X
+		maxY = size - layer.Y
+	)
+
+	switch a {
+	case AnchorTopLeft, AnchorLeft, AnchorBottomLeft:
+		p.X = 0
+	case AnchorTopRight, AnchorRight, AnchorBottomRight:
+		p.X = maxX
+	}
+	switch a {
+	case AnchorTopLeft, AnchorTop, AnchorTopRight:
+		p.Y = 0
+	case AnchorBottomLeft, AnchorBottom, AnchorBottomRight:
+		p.Y = maxY
+	}
+
+	return p
+}
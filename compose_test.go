@@ -0,0 +1,123 @@
+package winres
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func uniformImage(size int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestComposeIcon(t *testing.T) {
+	var (
+		red   = color.NRGBA{R: 0xFF, A: 0xFF}
+		green = color.NRGBA{G: 0xFF, A: 0xFF}
+		blue  = color.NRGBA{B: 0xFF, A: 0xFF}
+	)
+
+	icon, err := ComposeIcon([]IconLayer{
+		{Image: uniformImage(64, red)},
+		{Image: uniformImage(10, green), Scale: 0.5},
+		{Image: uniformImage(10, blue), Scale: 0.25, Anchor: AnchorBottomRight, MinSize: 32},
+	}, []int{64, 16}, WithResampling(ResampleNearestNeighbor))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := icon.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 || images[0].Bounds().Dx() != 64 || images[1].Bounds().Dx() != 16 {
+		t.Fatal("unexpected images")
+	}
+
+	checkImage(t, images[0], func(x, y int) color.NRGBA {
+		switch {
+		case x >= 48 && y >= 48:
+			return blue
+		case x >= 16 && x < 48 && y >= 16 && y < 48:
+			return green
+		}
+		return red
+	})
+	// The badge is hidden at 16px
+	checkImage(t, images[1], func(x, y int) color.NRGBA {
+		if x >= 4 && x < 12 && y >= 4 && y < 12 {
+			return green
+		}
+		return red
+	})
+}
+
+func TestComposeIcon_Anchors(t *testing.T) {
+	var (
+		white = color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+		black = color.NRGBA{A: 0xFF}
+	)
+
+	for _, tt := range []struct {
+		anchor anchor
+		x, y   int
+	}{
+		{AnchorCenter, 12, 12},
+		{AnchorTopLeft, 0, 0},
+		{AnchorTop, 12, 0},
+		{AnchorTopRight, 24, 0},
+		{AnchorLeft, 0, 12},
+		{AnchorRight, 24, 12},
+		{AnchorBottomLeft, 0, 24},
+		{AnchorBottom, 12, 24},
+		{AnchorBottomRight, 24, 24},
+	} {
+		icon, err := ComposeIcon([]IconLayer{
+			{Image: uniformImage(32, black)},
+			{Image: uniformImage(8, white), Scale: 0.25, Anchor: tt.anchor},
+		}, []int{32}, WithResampling(ResampleNearestNeighbor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		images, err := icon.Images()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkImage(t, images[0], func(x, y int) color.NRGBA {
+			if x >= tt.x && x < tt.x+8 && y >= tt.y && y < tt.y+8 {
+				return white
+			}
+			return black
+		})
+	}
+}
+
+func TestComposeIcon_Err(t *testing.T) {
+	img := uniformImage(16, color.NRGBA{})
+
+	for _, tt := range []struct {
+		name   string
+		layers []IconLayer
+		sizes  []int
+		err    string
+	}{
+		{"nil image", []IconLayer{{}}, nil, errInvalidImageDimensions},
+		{"empty image", []IconLayer{{Image: image.NewNRGBA(image.Rectangle{})}}, nil, errInvalidImageDimensions},
+		{"negative scale", []IconLayer{{Image: img, Scale: -1}}, nil, errInvalidImageDimensions},
+		{"size", []IconLayer{{Image: img}}, []int{257}, errInvalidImageDimensions},
+		{"too many sizes", []IconLayer{{Image: img}}, make([]int, 31), errTooManyIconSizes},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			icon, err := ComposeIcon(tt.layers, tt.sizes)
+			if icon != nil || err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"image"
 	"io"
+	"math"
 	"sort"
 
 	"golang.org/x/image/bmp"
@@ -14,7 +16,7 @@ import (
 // Cursor describes a mouse cursor.
 //
 // This structure must only be created by constructors:
-// NewCursorFromImages, LoadCUR
+// NewCursorFromImages, NewCursorFromResizedImage, CursorFromIcon, LoadCUR
 type Cursor struct {
 	images []cursorImage
 }
@@ -33,19 +35,166 @@ type HotSpot struct {
 	Y uint16
 }
 
+// DefaultCursorSizes are the sizes made by NewCursorFromResizedImage when sizes is nil.
+var DefaultCursorSizes = []int{128, 96, 64, 48, 32}
+
+type cursorOptions struct {
+	png      bool
+	pngSizes map[int]bool
+}
+
+type cursorOption func(opt *cursorOptions)
+
+// WithCursorPNG stores cursor images as 32bpp PNG instead of DIB.
+//
+// The format applies to the given sizes only, or to every size if none is given.
+//
+// PNG cursors are supported since Windows Vista. They are much smaller for large sizes.
+func WithCursorPNG(sizes ...int) cursorOption {
+	return func(opt *cursorOptions) {
+		if len(sizes) == 0 {
+			opt.png = true
+			return
+		}
+		if opt.pngSizes == nil {
+			opt.pngSizes = make(map[int]bool)
+		}
+		for _, s := range sizes {
+			opt.pngSizes[s] = true
+		}
+	}
+}
+
+func makeCursorOptions(opt []cursorOption) cursorOptions {
+	options := cursorOptions{}
+	for _, o := range opt {
+		o(&options)
+	}
+	return options
+}
+
+// isPNG tells if an image of a given size should be stored as PNG.
+func (options *cursorOptions) isPNG(size int) bool {
+	return options.png || options.pngSizes[size]
+}
+
 // NewCursorFromImages makes a cursor from a list of images and hot spots.
-func NewCursorFromImages(images []CursorImage) (*Cursor, error) {
-	cursor := &Cursor{}
+//
+// This converts every image to DIB, unless WithCursorPNG is used.
+func NewCursorFromImages(images []CursorImage, opt ...cursorOption) (*Cursor, error) {
+	var (
+		cursor  = &Cursor{}
+		options = makeCursorOptions(opt)
+	)
 
 	for _, img := range images {
-		if err := cursor.addImage(img.Image, img.HotSpot); err != nil {
+		if err := cursor.addImage(img.Image, img.HotSpot, &options); err != nil {
+			return nil, err
+		}
+	}
+
+	return cursor, nil
+}
+
+// NewCursorFromResizedImage makes a cursor from a single Image by resizing it.
+//
+// The hot spot is given in the coordinates of img, and it is scaled for each size.
+//
+// If sizes is nil, the cursor will be resized to: 128px, 96px, 64px, 48px, 32px.
+//
+// It accepts the same options as NewCursorFromImages.
+func NewCursorFromResizedImage(img image.Image, hotSpot HotSpot, sizes []int, opt ...cursorOption) (*Cursor, error) {
+	if sizes == nil {
+		sizes = DefaultCursorSizes
+	}
+	if len(sizes) > 30 {
+		return nil, errors.New(errTooManyIconSizes)
+	}
+
+	var (
+		cursor        = &Cursor{}
+		options       = makeCursorOptions(opt)
+		resizeOptions = makeIconOptions(nil)
+		sz            = img.Bounds().Size()
+		length        = sz.X
+	)
+	if length < sz.Y {
+		length = sz.Y
+	}
+	if img.Bounds().Empty() {
+		return nil, errors.New(errInvalidImageDimensions)
+	}
+
+	for _, s := range sizes {
+		if s < 1 || s > 256 {
+			return nil, errors.New(errInvalidImageDimensions)
+		}
+		scale := float64(s) / float64(length)
+		hs := HotSpot{
+			X: scaleHotSpot(hotSpot.X, scale, s),
+			Y: scaleHotSpot(hotSpot.Y, scale, s),
+		}
+		if err := cursor.addImage(resizeImage(img, s, &resizeOptions), hs, &options); err != nil {
+			return nil, err
+		}
+	}
+
+	return cursor, nil
+}
+
+// CursorFromIcon makes a cursor from the images of an icon, without re-encoding them.
+//
+// The hot spot is given in the coordinates of the largest image, and it is scaled for the other sizes.
+func CursorFromIcon(icon *Icon, hotSpot HotSpot) (*Cursor, error) {
+	icon.order()
+
+	largest := 0
+	for i := range icon.images {
+		if w := int(icon.images[i].info.Width-1) + 1; w > largest {
+			largest = w
+		}
+	}
+
+	cursor := &Cursor{}
+	for i := range icon.images {
+		img := &icon.images[i]
+		hdr, err := readIconImageHeader(img.image)
+		if err != nil {
 			return nil, err
 		}
+		var (
+			width  = int(img.info.Width-1) + 1
+			height = int(img.info.Height-1) + 1
+			scale  = float64(width) / float64(largest)
+		)
+		cursor.images = append(cursor.images, cursorImage{
+			info: cursorInfo{
+				Width:      uint16(width),
+				Height:     uint16(height),
+				Planes:     1,
+				BitCount:   uint16(hdr.bitCount),
+				BytesInRes: uint32(len(img.image) + 4), // +4 for the hot spot
+			},
+			hotSpot: HotSpot{
+				X: scaleHotSpot(hotSpot.X, scale, width),
+				Y: scaleHotSpot(hotSpot.Y, scale, height),
+			},
+			image: img.image,
+		})
 	}
 
 	return cursor, nil
 }
 
+// scaleHotSpot scales a hot spot coordinate, keeping it inside an image of a given size.
+func scaleHotSpot(v uint16, scale float64, size int) uint16 {
+	v = uint16(math.Round(float64(v) * scale))
+	if int(v) >= size {
+		return uint16(size - 1)
+	}
+	return v
+}
+
 // LoadCUR loads a CUR file and returns a cursor, ready to embed in a resource set.
 func LoadCUR(cur io.ReadSeeker) (*Cursor, error) {
 	hdr := cursorDirHeader{}
@@ -100,6 +249,34 @@ func LoadCUR(cur io.ReadSeeker) (*Cursor, error) {
 	return cursor, nil
 }
 
+// Validate checks that the directory entries of the cursor match the actual images.
+//
+// It performs the same checks as Icon.Validate.
+// The declared height may be doubled, and the declared length may include the 4 bytes of the hot spot,
+// as in RT_CURSOR resources.
+func (cursor *Cursor) Validate() error {
+	seen := make(map[iconImageHeader]bool)
+	for i := range cursor.images {
+		img := &cursor.images[i]
+		height := int(img.info.Height)
+		if hdr, err := readIconImageHeader(img.image); err == nil && hdr.height*2 == height {
+			height = hdr.height
+		}
+		hdr, err := validateImage(img.image, int(img.info.Width), height, int(img.info.BitCount))
+		if n := img.info.BytesInRes; err == nil && n != uint32(len(img.image)) && n != uint32(len(img.image)+4) {
+			err = errors.New(errLengthMismatch)
+		}
+		if err == nil && seen[hdr] {
+			err = errors.New(errDuplicateImage)
+		}
+		if err != nil {
+			return fmt.Errorf("image %d: %w", i, err)
+		}
+		seen[hdr] = true
+	}
+	return nil
+}
+
 // SaveCUR saves a cursor as a CUR file.
 func (cursor *Cursor) SaveCUR(ico io.Writer) error {
 	err := binary.Write(ico, binary.LittleEndian, &cursorDirHeader{
@@ -143,13 +320,40 @@ func (cursor *Cursor) SaveCUR(ico io.Writer) error {
 	return nil
 }
 
+// Images decodes every image of the cursor, along with its hot spot.
+//
+// Images are returned in the order they are stored, which is by descending size and quality
+// once the cursor has been saved or added to a resource set.
+func (cursor *Cursor) Images() ([]CursorImage, error) {
+	images := make([]CursorImage, len(cursor.images))
+	for i := range cursor.images {
+		img, err := decodeIconImage(cursor.images[i].image)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = CursorImage{
+			Image:   img,
+			HotSpot: cursor.images[i].hotSpot,
+		}
+	}
+	return images, nil
+}
+
 // SetCursor adds the cursor to the resource set.
-func (rs *ResourceSet) SetCursor(resID Identifier, cursor *Cursor) error {
-	return rs.SetCursorTranslation(resID, LCIDNeutral, cursor)
+func (rs *ResourceSet) SetCursor(resID Identifier, cursor *Cursor, opt ...resourceOption) error {
+	return rs.SetCursorTranslation(resID, LCIDNeutral, cursor, opt...)
 }
 
 // SetCursorTranslation adds the cursor to a specific language in the resource set.
-func (rs *ResourceSet) SetCursorTranslation(resID Identifier, langID uint16, cursor *Cursor) error {
+//
+// When the cursor replaces another one, PruneReplacedImages removes the former images.
+func (rs *ResourceSet) SetCursorTranslation(resID Identifier, langID uint16, cursor *Cursor, opt ...resourceOption) error {
+	options := makeResourceOptions(opt)
+	var replaced []uint16
+	if options.pruneReplaced {
+		replaced = groupImageIDs(rs.Get(RT_GROUP_CURSOR, resID, langID))
+	}
+
 	b := &bytes.Buffer{}
 	binary.Write(b, binary.LittleEndian, cursorDirHeader{
 		Type:  2,
@@ -169,7 +373,14 @@ func (rs *ResourceSet) SetCursorTranslation(resID Identifier, langID uint16, cur
 			return err
 		}
 	}
-	return rs.Set(RT_GROUP_CURSOR, resID, langID, b.Bytes())
+	if err := rs.Set(RT_GROUP_CURSOR, resID, langID, b.Bytes()); err != nil {
+		return err
+	}
+
+	if len(replaced) > 0 {
+		rs.pruneImages(RT_CURSOR, RT_GROUP_CURSOR, replaced)
+	}
+	return nil
 }
 
 // GetCursor extracts a cursor from a resource set.
@@ -264,7 +475,7 @@ func (ci *cursorImage) resData() []byte {
 // This makes a testing error reporting possible
 var bmpEncode = bmp.Encode
 
-func (cursor *Cursor) addImage(img image.Image, hotSpot HotSpot) error {
+func (cursor *Cursor) addImage(img image.Image, hotSpot HotSpot, options *cursorOptions) error {
 	bounds := img.Bounds()
 	if bounds.Empty() {
 		return errors.New(errInvalidImageDimensions)
@@ -273,11 +484,31 @@ func (cursor *Cursor) addImage(img image.Image, hotSpot HotSpot) error {
 		return errors.New(errImageTooBig)
 	}
 
-	// PNG seems to be supported, and simpler. (no need to double the height or to skip a part of the header)
-	// But I've never seen PNG cursors and I would not take the risk.
-	// PNG icons, on the other hand, are very common.
-	buf := &bytes.Buffer{}
 	curImg := imageInSquareNRGBA(img, false)
+	width, height := curImg.Bounds().Size().X, curImg.Bounds().Size().Y
+
+	if options.isPNG(width) {
+		// PNG is simpler: there is no need to double the height or to skip a part of the header.
+		buf := &bytes.Buffer{}
+		if err := pngEncode(buf, curImg); err != nil {
+			return err
+		}
+		cursor.images = append(cursor.images, cursorImage{
+			info: cursorInfo{
+				Width:      uint16(width),
+				Height:     uint16(height),
+				Planes:     1,
+				BitCount:   32,
+				BytesInRes: uint32(buf.Len() + 4), // +4 for the hot spot
+			},
+			hotSpot: hotSpot,
+			image:   buf.Bytes(),
+		})
+		return nil
+	}
+
+	// DIB is the default, because PNG cursors are not supported before Windows Vista.
+	buf := &bytes.Buffer{}
 	if err := bmpEncode(buf, curImg); err != nil {
 		return err
 	}
@@ -286,18 +517,24 @@ func (cursor *Cursor) addImage(img image.Image, hotSpot HotSpot) error {
 	// A BMP file is a BMPFILEHEADER followed by a DIB.
 	dib := buf.Bytes()[14:]
 
-	width, height := curImg.Bounds().Size().X, curImg.Bounds().Size().Y
 	// Height must be doubled in the DIB header, as if there was an AND mask for transparency.
 	// In a 32 bits DIB, the mask can be the alpha channel, therefore there is no AND mask.
 	dib[8] = byte(height << 1)
 	dib[9] = byte(height >> 7)
 
+	// Opaque images are encoded as 24 bits DIB, so they need an actual AND mask, in which every pixel is opaque.
+	bitCount := uint16(dib[15])<<8 | uint16(dib[14])
+	if bitCount < 32 {
+		maskStride := (width + 31) / 32 * 4
+		dib = append(dib, make([]byte, maskStride*height)...)
+	}
+
 	cursor.images = append(cursor.images, cursorImage{
 		info: cursorInfo{
 			Width:      uint16(width),
 			Height:     uint16(height),
 			Planes:     1,
-			BitCount:   32,
+			BitCount:   bitCount,
 			BytesInRes: uint32(len(dib) + 4), // +4 for the hot spot
 		},
 		hotSpot: hotSpot,
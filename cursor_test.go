@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"image"
+	"image/color"
 	"io"
 	"os"
 	"path/filepath"
@@ -311,6 +312,121 @@ func TestNewCursorFromImages_ErrEncode(t *testing.T) {
 	}
 }
 
+func TestNewCursorFromImages_Opaque(t *testing.T) {
+	opaque := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 0xFF
+	}
+	opaque.Pix[2] = 0x80
+
+	cursor, err := NewCursorFromImages([]CursorImage{{opaque, HotSpot{1, 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 24 bits pixels followed by a 1 bit AND mask
+	img := cursor.images[0]
+	if img.info.BitCount != 24 || len(img.image) != 40+120*40+8*40 || img.info.BytesInRes != uint32(len(img.image)+4) {
+		t.Fatal("unexpected image data")
+	}
+	hdr, err := readIconImageHeader(img.image)
+	if err != nil || hdr.bitCount != 24 || hdr.width != 40 || hdr.height != 40 {
+		t.Fatal("unexpected DIB header")
+	}
+	if cursor.Validate() != nil {
+		t.Error("invalid cursor")
+	}
+	images, err := cursor.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, images[0].Image, func(x, y int) color.NRGBA { return opaque.NRGBAAt(x, y) })
+}
+
+func TestNewCursorFromImages_Padded(t *testing.T) {
+	// Opaque but not square, as the sources of TestNewCursorFromImages
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	for i := range src.Pix {
+		src.Pix[i] = 0xFF
+	}
+
+	cursor, err := NewCursorFromImages([]CursorImage{{src, HotSpot{1, 2}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The padding is transparent, so the image is a 32 bits DIB without an AND mask
+	img := cursor.images[0]
+	if img.info.BitCount != 32 || len(img.image) != 40+16*16*4 {
+		t.Fatal("unexpected image data", img.info.BitCount, len(img.image))
+	}
+	hdr, err := readIconImageHeader(img.image)
+	if err != nil || hdr.bitCount != 32 || hdr.width != 16 || hdr.height != 16 {
+		t.Fatal("unexpected DIB header")
+	}
+}
+
+func TestNewCursorFromImages_PNG(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+
+	cursor, err := NewCursorFromResizedImage(src, HotSpot{10, 20}, []int{128, 64, 32}, WithCursorPNG(128, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := ResourceSet{}
+	rs.SetCursor(ID(1), cursor)
+	cursor, err = rs.GetCursor(ID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cursor.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, isPNG := range []bool{true, true, false} {
+		if bytes.HasPrefix(cursor.images[i].image, pngSignature) != isPNG {
+			t.Errorf("image %d: PNG should be %v", i, isPNG)
+		}
+	}
+	images, err := cursor.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if images[1].HotSpot != (HotSpot{10, 20}) {
+		t.Error("wrong hot spot", images[1].HotSpot)
+	}
+	checkImage(t, images[1].Image, func(x, y int) color.NRGBA {
+		if y >= 48 {
+			return color.NRGBA{}
+		}
+		return src.NRGBAAt(x, y)
+	})
+
+	cursor, err = NewCursorFromImages([]CursorImage{{src, HotSpot{}}}, WithCursorPNG())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(cursor.images[0].image, pngSignature) || cursor.images[0].info.BitCount != 32 {
+		t.Error("expected a 32bpp PNG")
+	}
+}
+
+func TestNewCursorFromImages_ErrEncodePNG(t *testing.T) {
+	enc := pngEncode
+	defer func() { pngEncode = enc }()
+	pngEncode = func(w io.Writer, m image.Image) error {
+		return errors.New("oops")
+	}
+
+	_, err := NewCursorFromImages([]CursorImage{{image.NewNRGBA(image.Rect(0, 0, 32, 32)), HotSpot{}}}, WithCursorPNG())
+	if err == nil || err.Error() != "oops" {
+		t.Fail()
+	}
+}
+
 func TestNewCursorFromImages_ErrTooBig(t *testing.T) {
 	_, err := NewCursorFromImages([]CursorImage{
 		{
@@ -358,6 +474,78 @@ func TestNewCursorFromImages_ErrTooBig(t *testing.T) {
 	}
 }
 
+func TestNewCursorFromResizedImage(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(10, 20, 74, 52))
+	for i := range src.Pix {
+		src.Pix[i] = 0xFF
+	}
+
+	cursor, err := NewCursorFromResizedImage(src, HotSpot{63, 10}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := cursor.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []CursorImage{
+		{image.NewNRGBA(image.Rect(0, 0, 128, 128)), HotSpot{126, 20}},
+		{image.NewNRGBA(image.Rect(0, 0, 96, 96)), HotSpot{95, 15}},
+		{image.NewNRGBA(image.Rect(0, 0, 64, 64)), HotSpot{63, 10}},
+		{image.NewNRGBA(image.Rect(0, 0, 48, 48)), HotSpot{47, 8}},
+		{image.NewNRGBA(image.Rect(0, 0, 32, 32)), HotSpot{31, 5}},
+	}
+	if len(images) != len(expected) {
+		t.Fatal("expected", len(expected), "images, got", len(images))
+	}
+	for i := range images {
+		if images[i].Image.Bounds() != expected[i].Image.Bounds() || images[i].HotSpot != expected[i].HotSpot {
+			t.Errorf("image %d: got %v %v, expected %v %v", i, images[i].Image.Bounds(), images[i].HotSpot,
+				expected[i].Image.Bounds(), expected[i].HotSpot)
+		}
+	}
+	// The image is not centered, so the hot spot stays on the same pixel
+	size := images[4].Image.Bounds().Size()
+	checkImage(t, images[4].Image, func(x, y int) color.NRGBA {
+		if y >= size.Y/2 {
+			return color.NRGBA{}
+		}
+		return color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+	})
+
+	cursor, err = NewCursorFromResizedImage(src, HotSpot{1000, 0}, []int{16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.images[0].hotSpot != (HotSpot{15, 0}) {
+		t.Error("the hot spot should be inside the image", cursor.images[0].hotSpot)
+	}
+}
+
+func TestNewCursorFromResizedImage_Err(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+
+	for _, tt := range []struct {
+		name  string
+		img   image.Image
+		sizes []int
+		err   string
+	}{
+		{"empty image", image.NewNRGBA(image.Rect(0, 0, 0, 16)), nil, errInvalidImageDimensions},
+		{"size 0", img, []int{32, 0}, errInvalidImageDimensions},
+		{"size 257", img, []int{257}, errInvalidImageDimensions},
+		{"too many sizes", img, make([]int, 31), errTooManyIconSizes},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := NewCursorFromResizedImage(tt.img, HotSpot{}, tt.sizes)
+			if cursor != nil || err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
 func TestResourceSet_SetCursor(t *testing.T) {
 	rs := ResourceSet{}
 
@@ -501,3 +689,205 @@ func curToBinary(cursor *Cursor) []byte {
 	cursor.SaveCUR(buf)
 	return buf.Bytes()
 }
+
+func TestCursor_Images(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 16, 24))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+	opaque := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 0xFF
+	}
+
+	cursor, err := NewCursorFromImages([]CursorImage{{src, HotSpot{3, 4}}, {opaque, HotSpot{5, 6}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := ResourceSet{}
+	rs.SetCursor(ID(1), cursor)
+	cursor, err = rs.GetCursor(ID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := cursor.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 || images[0].Image.Bounds() != image.Rect(0, 0, 24, 24) || images[1].Image.Bounds() != image.Rect(0, 0, 8, 8) {
+		t.Fatal("unexpected images")
+	}
+	if images[0].HotSpot != (HotSpot{3, 4}) || images[1].HotSpot != (HotSpot{5, 6}) {
+		t.Error("wrong hot spots")
+	}
+	checkImage(t, images[0].Image, func(x, y int) color.NRGBA {
+		if x >= 16 {
+			return color.NRGBA{}
+		}
+		return src.NRGBAAt(x, y)
+	})
+	checkImage(t, images[1].Image, func(x, y int) color.NRGBA { return opaque.NRGBAAt(x, y) })
+}
+
+func TestCursor_Images_Err(t *testing.T) {
+	cursor := &Cursor{images: []cursorImage{{image: []byte{12, 0, 0, 0}}}}
+	images, err := cursor.Images()
+	if err == nil || images != nil {
+		t.Fail()
+	}
+}
+
+func TestCursor_Validate(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	opaque := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range opaque.Pix {
+		opaque.Pix[i] = 0xFF
+	}
+	newCursor := func() *Cursor {
+		cursor, err := NewCursorFromImages([]CursorImage{{transparent, HotSpot{}}, {opaque, HotSpot{}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cursor
+	}
+
+	cursor := newCursor()
+	if err := cursor.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cursor.images[1].info.BitCount != 24 {
+		t.Error("an opaque image should be declared as 24 bpp")
+	}
+
+	// Same as an RT_GROUP_CURSOR resource
+	rs := ResourceSet{}
+	rs.SetCursor(ID(1), cursor)
+	cursor, _ = rs.GetCursor(ID(1))
+	if err := cursor.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Doubled height
+	cursor.images[0].info.Height = 64
+	if err := cursor.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		modify func(cursor *Cursor)
+		err    string
+	}{
+		{"width", func(cursor *Cursor) { cursor.images[1].info.Width = 32 }, "image 1: " + errDimensionsMismatch},
+		{"height", func(cursor *Cursor) { cursor.images[0].info.Height = 48 }, "image 0: " + errDimensionsMismatch},
+		{"bit count", func(cursor *Cursor) { cursor.images[0].info.BitCount = 8 }, "image 0: " + errBitCountMismatch},
+		{"length", func(cursor *Cursor) { cursor.images[1].info.BytesInRes += 8 }, "image 1: " + errLengthMismatch},
+		{"duplicate", func(cursor *Cursor) { cursor.images = append(cursor.images, cursor.images[0]) }, "image 2: " + errDuplicateImage},
+		{"zero", func(cursor *Cursor) { cursor.images[0].image[4] = 0 }, "image 0: " + errInvalidImageDimensions},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := newCursor()
+			tt.modify(cursor)
+			err := cursor.Validate()
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestCursorFromIcon(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+	icon, err := NewIconFromResizedImage(src, []int{64, 32, 16}, WithIconFormat(IconBMP32, 32), WithIconFormat(IconBMP4, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := CursorFromIcon(icon, HotSpot{32, 63})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cursor.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for i, hs := range []HotSpot{{32, 63}, {16, 31}, {8, 15}} {
+		if cursor.images[i].hotSpot != hs {
+			t.Errorf("image %d: wrong hot spot %v", i, cursor.images[i].hotSpot)
+		}
+		if !bytes.Equal(cursor.images[i].image, icon.images[i].image) {
+			t.Errorf("image %d should not be re-encoded", i)
+		}
+	}
+	if cursor.images[2].info.BitCount != 4 {
+		t.Error("wrong bit count", cursor.images[2].info.BitCount)
+	}
+
+	// Check the round trip through a resource set
+	rs := ResourceSet{}
+	rs.SetCursor(ID(1), cursor)
+	cursor, err = rs.GetCursor(ID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := cursor.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	iconImages, _ := icon.Images()
+	for i := range images {
+		checkImage(t, images[i].Image, func(x, y int) color.NRGBA { return toNRGBA(iconImages[i]).NRGBAAt(x, y) })
+	}
+}
+
+func TestIconFromCursor(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+	cursor, err := NewCursorFromResizedImage(src, HotSpot{1, 2}, []int{256, 32}, WithCursorPNG(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	icon, err := IconFromCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = icon.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	entries := icon.Entries()
+	if !reflect.DeepEqual(entries, []IconEntry{
+		{Width: 256, Height: 256, BitCount: 32, PNG: true, Size: len(cursor.images[0].image)},
+		{Width: 32, Height: 32, BitCount: 32, Size: len(cursor.images[1].image)},
+	}) {
+		t.Error("unexpected entries", entries)
+	}
+	images, err := icon.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, images[1], func(x, y int) color.NRGBA { return src.NRGBAAt(x, y) })
+}
+
+func TestCursorFromIcon_Err(t *testing.T) {
+	icon := &Icon{images: []iconImage{{info: iconInfo{Width: 16, Height: 16}, image: []byte{12, 0, 0, 0}}}}
+	if cursor, err := CursorFromIcon(icon, HotSpot{}); cursor != nil || err == nil {
+		t.Error("expected an error")
+	}
+
+	cursor := &Cursor{images: []cursorImage{{info: cursorInfo{Width: 16, Height: 16}, image: []byte{12, 0, 0, 0}}}}
+	if icon, err := IconFromCursor(cursor); icon != nil || err == nil {
+		t.Error("expected an error")
+	}
+
+	cursor, _ = NewCursorFromImages([]CursorImage{{image.NewNRGBA(image.Rect(0, 0, 16, 16)), HotSpot{}}})
+	cursor.images[0].info.Width = 257
+	if icon, err := IconFromCursor(cursor); icon != nil || err == nil || err.Error() != errImageTooBig {
+		t.Error("expected error", errImageTooBig)
+	}
+}
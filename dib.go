@@ -0,0 +1,306 @@
+package winres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math/bits"
+)
+
+// Images stored in icons and cursors are either PNG files or DIBs,
+// which are BMP files without their BITMAPFILEHEADER.
+//
+// In a DIB, the height is doubled, as if the image was followed by an AND mask of the same size.
+// The AND mask is a 1bpp bitmap in which 1 means transparent.
+// In 32bpp DIBs, the alpha channel is used instead, but the AND mask may still be present.
+//
+// https://devblogs.microsoft.com/oldnewthing/20101018-00/?p=12513
+// https://docs.microsoft.com/en-us/windows/win32/api/wingdi/ns-wingdi-bitmapinfoheader
+
+// bitmapInfoHeader is the binary format of a BITMAPINFOHEADER.
+//
+// BITMAPV4HEADER and BITMAPV5HEADER start with the same fields.
+type bitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+const (
+	sizeOfBitmapInfoHeader = 40
+	sizeOfBitmapV4Header   = 108
+	sizeOfBitmapV5Header   = 124
+)
+
+const (
+	_BI_RGB       = 0
+	_BI_BITFIELDS = 3
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// decodeIconImage decodes an image stored in an icon or a cursor.
+func decodeIconImage(data []byte) (image.Image, error) {
+	if bytes.HasPrefix(data, pngSignature) {
+		return png.Decode(bytes.NewReader(data))
+	}
+	return decodeDIB(data)
+}
+
+// iconImageHeader describes an image stored in an icon or a cursor.
+type iconImageHeader struct {
+	width    int
+	height   int
+	bitCount int
+	png      bool
+}
+
+// readIconImageHeader reads the header of an image stored in an icon or a cursor, without decoding the image.
+func readIconImageHeader(data []byte) (iconImageHeader, error) {
+	if bytes.HasPrefix(data, pngSignature) {
+		cfg, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return iconImageHeader{}, err
+		}
+		return iconImageHeader{width: cfg.Width, height: cfg.Height, bitCount: 32, png: true}, nil
+	}
+
+	hdr := bitmapInfoHeader{}
+	if err := binaryRead(bytes.NewReader(data), &hdr); err != nil {
+		return iconImageHeader{}, err
+	}
+	if hdr.Size != sizeOfBitmapInfoHeader && hdr.Size != sizeOfBitmapV4Header && hdr.Size != sizeOfBitmapV5Header {
+		return iconImageHeader{}, errors.New(errUnknownImageFormat)
+	}
+	height := int(hdr.Height) / 2
+	if height < 0 {
+		height = -height
+	}
+	return iconImageHeader{width: int(hdr.Width), height: height, bitCount: int(hdr.BitCount)}, nil
+}
+
+// decodeDIB decodes a DIB image with a doubled height and an optional AND mask.
+func decodeDIB(data []byte) (image.Image, error) {
+	hdr := bitmapInfoHeader{}
+	if err := binaryRead(bytes.NewReader(data), &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Size != sizeOfBitmapInfoHeader && hdr.Size != sizeOfBitmapV4Header && hdr.Size != sizeOfBitmapV5Header {
+		return nil, errors.New(errUnknownImageFormat)
+	}
+
+	var (
+		width   = int(hdr.Width)
+		height  = int(hdr.Height) / 2
+		topDown = height < 0
+	)
+	if topDown {
+		height = -height
+	}
+	if width <= 0 || height <= 0 || width > 256 || height > 256 {
+		return nil, errors.New(errInvalidImageDimensions)
+	}
+
+	var (
+		pos     = int(hdr.Size)
+		palette []color.NRGBA
+		masks   = [4]uint32{0xFF0000, 0xFF00, 0xFF, 0xFF000000}
+	)
+	if len(data) < pos {
+		return nil, errors.New(errInvalidDIB)
+	}
+
+	switch {
+	case hdr.Compression == _BI_RGB && (hdr.BitCount == 1 || hdr.BitCount == 4 || hdr.BitCount == 8):
+		n := int(hdr.ClrUsed)
+		if n == 0 || n > 1<<hdr.BitCount {
+			n = 1 << hdr.BitCount
+		}
+		if len(data) < pos+n*4 {
+			return nil, errors.New(errInvalidDIB)
+		}
+		palette = make([]color.NRGBA, n)
+		for i := range palette {
+			// RGBQUAD
+			palette[i] = color.NRGBA{R: data[pos+2], G: data[pos+1], B: data[pos], A: 0xFF}
+			pos += 4
+		}
+	case hdr.Compression == _BI_RGB && (hdr.BitCount == 24 || hdr.BitCount == 32):
+	case hdr.Compression == _BI_BITFIELDS && hdr.BitCount == 32:
+		if hdr.Size == sizeOfBitmapInfoHeader {
+			// Color masks follow the header
+			if len(data) < pos+12 {
+				return nil, errors.New(errInvalidDIB)
+			}
+			masks[3] = 0
+			pos += 12
+		}
+		for i := 0; i < 3; i++ {
+			masks[i] = uint32(data[sizeOfBitmapInfoHeader+i*4]) |
+				uint32(data[sizeOfBitmapInfoHeader+i*4+1])<<8 |
+				uint32(data[sizeOfBitmapInfoHeader+i*4+2])<<16 |
+				uint32(data[sizeOfBitmapInfoHeader+i*4+3])<<24
+		}
+		if hdr.Size != sizeOfBitmapInfoHeader {
+			masks[3] = uint32(data[52]) | uint32(data[53])<<8 | uint32(data[54])<<16 | uint32(data[55])<<24
+		}
+	default:
+		return nil, errors.New(errUnsupportedDIB)
+	}
+
+	var (
+		stride     = (width*int(hdr.BitCount) + 31) / 32 * 4
+		maskStride = (width + 31) / 32 * 4
+		maskPos    = pos + stride*height
+		hasMask    = len(data) >= maskPos+maskStride*height
+		hasAlpha   = false
+		img        = image.NewNRGBA(image.Rect(0, 0, width, height))
+	)
+	if len(data) < maskPos {
+		return nil, errors.New(errInvalidDIB)
+	}
+
+	for y := 0; y < height; y++ {
+		row := y
+		if !topDown {
+			row = height - 1 - y
+		}
+		line := data[pos+row*stride:]
+		for x := 0; x < width; x++ {
+			var c color.NRGBA
+			switch hdr.BitCount {
+			case 1, 4, 8:
+				bpp := int(hdr.BitCount)
+				i := int(line[x*bpp/8]>>(8-bpp-x*bpp%8)) & (1<<bpp - 1)
+				if i < len(palette) {
+					c = palette[i]
+				} else {
+					c = color.NRGBA{A: 0xFF}
+				}
+			case 24:
+				c = color.NRGBA{R: line[x*3+2], G: line[x*3+1], B: line[x*3], A: 0xFF}
+			case 32:
+				v := uint32(line[x*4]) | uint32(line[x*4+1])<<8 | uint32(line[x*4+2])<<16 | uint32(line[x*4+3])<<24
+				c = color.NRGBA{
+					R: maskedChannel(v, masks[0]),
+					G: maskedChannel(v, masks[1]),
+					B: maskedChannel(v, masks[2]),
+					A: maskedChannel(v, masks[3]),
+				}
+				hasAlpha = hasAlpha || c.A != 0
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	if hdr.BitCount == 32 && !hasAlpha {
+		// Old 32bpp images have an alpha channel full of zeros, the AND mask must be used instead
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 0xFF
+		}
+	}
+	if hasMask && (hdr.BitCount < 32 || !hasAlpha) {
+		for y := 0; y < height; y++ {
+			row := y
+			if !topDown {
+				row = height - 1 - y
+			}
+			line := data[maskPos+row*maskStride:]
+			for x := 0; x < width; x++ {
+				if line[x/8]&(0x80>>(x%8)) != 0 {
+					img.Pix[img.PixOffset(x, y)+3] = 0
+				}
+			}
+		}
+	}
+
+	return img, nil
+}
+
+// maskedChannel extracts a color channel from a pixel, given the channel's bit mask.
+func maskedChannel(v uint32, mask uint32) uint8 {
+	if mask == 0 {
+		return 0
+	}
+	v = (v & mask) >> bits.TrailingZeros32(mask)
+	n := bits.OnesCount32(mask)
+	if n >= 8 {
+		return uint8(v >> (n - 8))
+	}
+	// Scale smaller channels to 8 bits
+	return uint8(v * 0xFF / (1<<n - 1))
+}
+
+// encodeDIB encodes a square image as a DIB, with a doubled height and an AND mask, as found in icons.
+//
+// bitCount must be 4, 8 or 32. Paletted images are quantized.
+func encodeDIB(img *image.NRGBA, bitCount int) []byte {
+	var (
+		width, height = img.Bounds().Dx(), img.Bounds().Dy()
+		stride        = (width*bitCount + 31) / 32 * 4
+		maskStride    = (width + 31) / 32 * 4
+		buf           = &bytes.Buffer{}
+		palette       []color.NRGBA
+		indexes       []uint8
+	)
+
+	binary.Write(buf, binary.LittleEndian, bitmapInfoHeader{
+		Size:      sizeOfBitmapInfoHeader,
+		Width:     int32(width),
+		Height:    int32(height * 2),
+		Planes:    1,
+		BitCount:  uint16(bitCount),
+		SizeImage: uint32((stride + maskStride) * height),
+	})
+
+	if bitCount <= 8 {
+		palette, indexes = quantize(img, 1<<bitCount)
+		quads := make([]byte, 4<<bitCount)
+		for i, c := range palette {
+			quads[i*4], quads[i*4+1], quads[i*4+2] = c.B, c.G, c.R
+		}
+		buf.Write(quads)
+	}
+
+	line := make([]byte, stride)
+	for y := height - 1; y >= 0; y-- {
+		for i := range line {
+			line[i] = 0
+		}
+		for x := 0; x < width; x++ {
+			if bitCount == 32 {
+				c := img.NRGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)
+				line[x*4], line[x*4+1], line[x*4+2], line[x*4+3] = c.B, c.G, c.R, c.A
+				continue
+			}
+			line[x*bitCount/8] |= indexes[y*width+x] << (8 - bitCount - x*bitCount%8)
+		}
+		buf.Write(line)
+	}
+
+	mask := make([]byte, maskStride)
+	for y := height - 1; y >= 0; y-- {
+		for i := range mask {
+			mask[i] = 0
+		}
+		for x := 0; x < width; x++ {
+			if !isOpaque(img.NRGBAAt(img.Rect.Min.X+x, img.Rect.Min.Y+y)) {
+				mask[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		buf.Write(mask)
+	}
+
+	return buf.Bytes()
+}
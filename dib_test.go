@@ -0,0 +1,267 @@
+package winres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+)
+
+// makeTestDIB builds a bottom-up DIB, as found in icons, with an AND mask.
+//
+// pixel returns the raw value of a pixel, which is either a palette index or a BGR(A) color.
+func makeTestDIB(width, height, bitCount int, palette []color.NRGBA, pixel func(x, y int) uint32, transparent func(x, y int) bool) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, bitmapInfoHeader{
+		Size:     sizeOfBitmapInfoHeader,
+		Width:    int32(width),
+		Height:   int32(height * 2),
+		Planes:   1,
+		BitCount: uint16(bitCount),
+		ClrUsed:  uint32(len(palette)),
+	})
+	for _, c := range palette {
+		buf.Write([]byte{c.B, c.G, c.R, 0})
+	}
+
+	stride := (width*bitCount + 31) / 32 * 4
+	for y := height - 1; y >= 0; y-- {
+		line := make([]byte, stride)
+		for x := 0; x < width; x++ {
+			v := pixel(x, y)
+			switch bitCount {
+			case 1, 4, 8:
+				line[x*bitCount/8] |= byte(v << (8 - bitCount - x*bitCount%8))
+			case 24:
+				line[x*3], line[x*3+1], line[x*3+2] = byte(v), byte(v>>8), byte(v>>16)
+			case 32:
+				binary.LittleEndian.PutUint32(line[x*4:], v)
+			}
+		}
+		buf.Write(line)
+	}
+
+	maskStride := (width + 31) / 32 * 4
+	for y := height - 1; y >= 0; y-- {
+		line := make([]byte, maskStride)
+		for x := 0; x < width; x++ {
+			if transparent(x, y) {
+				line[x/8] |= 0x80 >> (x % 8)
+			}
+		}
+		buf.Write(line)
+	}
+
+	return buf.Bytes()
+}
+
+func checkImage(t *testing.T, img image.Image, expected func(x, y int) color.NRGBA) {
+	t.Helper()
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if e := expected(x, y); c != e && (c.A != 0 || e.A != 0) {
+				t.Fatalf("pixel (%d, %d) is %v, expected %v", x, y, c, e)
+			}
+		}
+	}
+}
+
+func TestDecodeDIB_Paletted(t *testing.T) {
+	palette := []color.NRGBA{
+		{R: 0x10, G: 0x20, B: 0x30, A: 0xFF},
+		{R: 0xF0, G: 0xE0, B: 0xD0, A: 0xFF},
+		{R: 0x80, G: 0x00, B: 0x00, A: 0xFF},
+		{R: 0x00, G: 0x80, B: 0x00, A: 0xFF},
+		{R: 0x00, G: 0x00, B: 0x80, A: 0xFF},
+	}
+	transparent := func(x, y int) bool { return x == y }
+
+	for _, bitCount := range []int{1, 4, 8} {
+		n := len(palette)
+		if bitCount == 1 {
+			n = 2
+		}
+		index := func(x, y int) uint32 { return uint32(x*3+y) % uint32(n) }
+
+		img, err := decodeIconImage(makeTestDIB(21, 13, bitCount, palette[:n], index, transparent))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds() != image.Rect(0, 0, 21, 13) {
+			t.Fatal("wrong bounds", img.Bounds())
+		}
+		checkImage(t, img, func(x, y int) color.NRGBA {
+			if transparent(x, y) {
+				return color.NRGBA{}
+			}
+			return palette[index(x, y)]
+		})
+	}
+}
+
+func TestDecodeDIB_24(t *testing.T) {
+	pixel := func(x, y int) uint32 { return uint32(x)<<16 | uint32(y)<<8 | 0x42 }
+	transparent := func(x, y int) bool { return y == 0 }
+
+	img, err := decodeIconImage(makeTestDIB(17, 9, 24, nil, pixel, transparent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, img, func(x, y int) color.NRGBA {
+		if transparent(x, y) {
+			return color.NRGBA{}
+		}
+		return color.NRGBA{R: uint8(x), G: uint8(y), B: 0x42, A: 0xFF}
+	})
+}
+
+func TestDecodeDIB_32(t *testing.T) {
+	pixel := func(x, y int) uint32 { return uint32(x*8)<<24 | uint32(x)<<16 | uint32(y)<<8 | 0x42 }
+
+	// The alpha channel is used, the AND mask is ignored
+	img, err := decodeIconImage(makeTestDIB(32, 32, 32, nil, pixel, func(x, y int) bool { return true }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, img, func(x, y int) color.NRGBA {
+		return color.NRGBA{R: uint8(x), G: uint8(y), B: 0x42, A: uint8(x * 8)}
+	})
+
+	// The alpha channel is empty, the AND mask is used
+	pixel = func(x, y int) uint32 { return uint32(x)<<16 | uint32(y)<<8 | 0x42 }
+	transparent := func(x, y int) bool { return x < y }
+	img, err = decodeIconImage(makeTestDIB(32, 32, 32, nil, pixel, transparent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, img, func(x, y int) color.NRGBA {
+		if transparent(x, y) {
+			return color.NRGBA{}
+		}
+		return color.NRGBA{R: uint8(x), G: uint8(y), B: 0x42, A: 0xFF}
+	})
+}
+
+func TestDecodeDIB_NoMask(t *testing.T) {
+	// Cursors made by this package have no AND mask
+	dib := makeTestDIB(8, 8, 24, nil, func(x, y int) uint32 { return 0x123456 }, func(x, y int) bool { return false })
+	img, err := decodeIconImage(dib[:len(dib)-8*4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, img, func(x, y int) color.NRGBA {
+		return color.NRGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xFF}
+	})
+}
+
+func TestDecodeDIB_TopDown(t *testing.T) {
+	dib := makeTestDIB(4, 4, 24, nil, func(x, y int) uint32 { return uint32(y) }, func(x, y int) bool { return false })
+	binary.LittleEndian.PutUint32(dib[8:], uint32(-8&0xFFFFFFFF))
+	img, err := decodeIconImage(dib)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, img, func(x, y int) color.NRGBA {
+		return color.NRGBA{B: uint8(3 - y), A: 0xFF}
+	})
+}
+
+func TestDecodeIconImage_PNG(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 5, 3))
+	src.SetNRGBA(1, 2, color.NRGBA{R: 1, G: 2, B: 3, A: 4})
+	buf := &bytes.Buffer{}
+	png.Encode(buf, src)
+
+	img, err := decodeIconImage(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, img, func(x, y int) color.NRGBA { return src.NRGBAAt(x, y) })
+}
+
+func TestDecodeDIB_Err(t *testing.T) {
+	pixel := func(x, y int) uint32 { return 0 }
+	mask := func(x, y int) bool { return false }
+	valid := makeTestDIB(4, 4, 8, make([]color.NRGBA, 2), pixel, mask)
+
+	hdr := func(f func(dib []byte)) []byte {
+		dib := append([]byte{}, valid...)
+		f(dib)
+		return dib
+	}
+
+	for _, tt := range []struct {
+		name string
+		dib  []byte
+		err  string
+	}{
+		{"short header", valid[:20], io.ErrUnexpectedEOF.Error()},
+		{"header size", hdr(func(dib []byte) { dib[0] = 12 }), errUnknownImageFormat},
+		{"width", hdr(func(dib []byte) { dib[4] = 0 }), errInvalidImageDimensions},
+		{"height", hdr(func(dib []byte) { dib[8], dib[9] = 0x02, 0x02 }), errInvalidImageDimensions},
+		{"bit count", hdr(func(dib []byte) { dib[14] = 16 }), errUnsupportedDIB},
+		{"compression", hdr(func(dib []byte) { dib[16] = 1 }), errUnsupportedDIB},
+		{"palette", valid[:44], errInvalidDIB},
+		{"pixels", valid[:60], errInvalidDIB},
+		{"v4 header", hdr(func(dib []byte) { dib[0], dib[14], dib[16] = 108, 32, 3 })[:50], errInvalidDIB},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeIconImage(tt.dib)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestEncodeDIB(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(x % 3 * 100), G: uint8(y % 5 * 50), B: 0x42, A: uint8(x * 12)})
+		}
+	}
+
+	for _, bitCount := range []int{32, 8, 4} {
+		// Header, palette, pixels and AND mask
+		length := 40 + (20*bitCount+31)/32*4*20 + 4*20
+		if bitCount < 32 {
+			length += 4 << bitCount
+		}
+		dib := encodeDIB(src, bitCount)
+		if len(dib) != length {
+			t.Error("wrong DIB length for", bitCount, "bpp:", len(dib))
+		}
+		img, err := decodeDIB(dib)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 15 distinct colors fit in a 4bpp palette along with black
+		checkImage(t, img, func(x, y int) color.NRGBA {
+			c := src.NRGBAAt(x, y)
+			switch {
+			case bitCount == 32:
+				return c
+			case !isOpaque(c):
+				return color.NRGBA{}
+			}
+			return color.NRGBA{R: c.R, G: c.G, B: c.B, A: 0xFF}
+		})
+	}
+}
+
+func TestEncodeDIB_SubImage(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	src.SetNRGBA(5, 6, color.NRGBA{R: 0xFF, A: 0xFF})
+	sub := src.SubImage(image.Rect(4, 4, 8, 8)).(*image.NRGBA)
+
+	img, err := decodeDIB(encodeDIB(sub, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, img, func(x, y int) color.NRGBA { return sub.NRGBAAt(x+4, y+4) })
+}
@@ -20,6 +20,14 @@ const (
 	errImageTooBig            = "image size too big, must fit in 256x256"
 	errNotCUR                 = "not a valid CUR file"
 	errUnknownImageFormat     = "unknown image format"
+	errInvalidDIB             = "invalid DIB image"
+	errUnsupportedDIB         = "unsupported DIB format"
+	errLengthMismatch         = "declared length does not match image data"
+	errDimensionsMismatch     = "declared dimensions do not match image"
+	errBitCountMismatch       = "declared bit count does not match image"
+	errDuplicateImage         = "duplicate image dimensions and bit count"
+	errEntryIndexOutOfRange   = "entry index out of range"
+	errNoICNSSize             = "no image size is supported by ICNS"
 
 	errInvalidResDir        = "invalid resource directory"
 	errDataEntryOutOfBounds = "data entry out of bounds"
@@ -33,6 +41,9 @@ const (
 	errNoRoomForRSRC = "not enough room to add .rsrc section header"
 	errRSRCTwice     = "found resource section twice"
 	errRelocTwice    = "found reloc section twice"
+	errOverlay       = "executable has data appended after its last section"
+
+	errDeleteExisting = "DeleteExistingResources is only supported by UpdateEXE and UpdateEXEFile"
 
 	errInvalidVersion      = "invalid version number"
 	errUnknownSupportedOS  = "unknown minimum-os value"
@@ -45,3 +56,6 @@ var ErrNoResources = errors.New(errNoRSRC)
 
 // ErrSignedPE is the error returned by WriteToEXE when it refused to touch signed code. (Authenticode)
 var ErrSignedPE = errors.New(errSignedPE)
+
+// ErrOverlay is the error returned by WriteToEXE when it refused to touch an executable with overlay data.
+var ErrOverlay = errors.New(errOverlay)
@@ -7,6 +7,9 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
 )
 
 type authenticodeHandling int
@@ -22,9 +25,24 @@ const (
 	IgnoreSignature authenticodeHandling = 2
 )
 
+type overlayHandling int
+
+const (
+	// KeepOverlay means winres will keep data appended after the last section,
+	// such as a self-extractor payload or a zip archive, at the end of the patched executable.
+	KeepOverlay overlayHandling = 0
+	// RemoveOverlay means winres will drop data appended after the last section.
+	RemoveOverlay overlayHandling = 1
+	// ErrorIfOverlay means winres won't patch an executable that has data appended after the last section.
+	ErrorIfOverlay overlayHandling = 2
+)
+
 type exeOptions struct {
 	forceCheckSum        bool
 	authenticodeHandling authenticodeHandling
+	overlayHandling      overlayHandling
+	deleteExisting       bool
+	reclaimOldRSRC       bool
 }
 
 type exeOption func(opt *exeOptions)
@@ -43,6 +61,47 @@ func WithAuthenticode(handling authenticodeHandling) exeOption {
 	}
 }
 
+// WithOverlay defines what to do with data appended after the last section of an executable (the "overlay").
+//
+// The certificate table of a signed executable is not considered as overlay data, see WithAuthenticode.
+func WithOverlay(handling overlayHandling) exeOption {
+	return func(opt *exeOptions) {
+		opt.overlayHandling = handling
+	}
+}
+
+// DeleteExistingResources makes UpdateEXE start from an empty ResourceSet instead of the executable's resources.
+//
+// This is like calling BeginUpdateResource with bDeleteExistingResources set to TRUE.
+//
+// Only UpdateEXE and UpdateEXEFile accept it. WriteToEXE and PatchEXEFile return an error,
+// because they always replace every resource.
+func DeleteExistingResources() exeOption {
+	return func(opt *exeOptions) {
+		opt.deleteExisting = true
+	}
+}
+
+// ReclaimOldRSRC removes "old.rsrc" sections, which are left in place when the .rsrc section cannot grow.
+//
+// Their data is removed from the file, and the sections themselves are removed when they are the last ones in memory.
+// Otherwise, their address range is reused by the new .rsrc section when it is large enough,
+// either because .rsrc has to be relocated, or because .rsrc is followed by movable sections only,
+// in which case the former .rsrc section is removed.
+func ReclaimOldRSRC() exeOption {
+	return func(opt *exeOptions) {
+		opt.reclaimOldRSRC = true
+	}
+}
+
+func makeEXEOptions(opt []exeOption) exeOptions {
+	options := exeOptions{}
+	for _, o := range opt {
+		o(&options)
+	}
+	return options
+}
+
 type peHeaders struct {
 	file        pe.FileHeader
 	opt         peOptionalHeader
@@ -240,21 +299,36 @@ type peWriter struct {
 	rsrcData []byte
 	rsrcHdr  *pe.SectionHeader32
 	relocHdr *pe.SectionHeader32
-	src      struct {
-		r          io.ReadSeeker
-		fileSize   int64
-		sigSize    int64 // size of a code signature we'd want to skip (only if it is at the end of the file)
-		dataOffset uint32
-		dataEnd    uint32
-		virtEnd    uint32
-		rsrcEnd    int64
+	// rsrcVirtSize is the minimum virtual size of .rsrc, so that the sections that follow it don't move
+	rsrcVirtSize uint32
+	src          struct {
+		r             io.ReadSeeker
+		fileSize      int64
+		sigSize       int64 // size of a code signature we'd want to skip (only if it is at the end of the file)
+		certOffset    int64 // raw offset of the certificate table, or 0
+		dataOffset    uint32
+		dataEnd       uint32
+		virtEnd       uint32
+		rsrcOffset    int64 // raw offset of the .rsrc section, which will be replaced or removed
+		rsrcEnd       int64
+		overlayOffset int64 // raw offset of data appended after the last section
+		overlayEnd    int64 // end of that data, which is either the certificate table or the end of the file
+		removed       []rawRange
 	}
+	appendRSRC  bool // the new .rsrc section is added after the last section
+	dropOverlay bool
+}
+
+// rawRange is a range of file offsets in the source executable.
+type rawRange struct {
+	start int64
+	end   int64
 }
 
 func replaceRSRCSection(dst io.Writer, src io.ReadSeeker, rsrcData []byte, reloc []int, options exeOptions) error {
 	src.Seek(0, io.SeekStart)
 
-	pew, err := preparePEWriter(src, rsrcData, options.authenticodeHandling)
+	pew, err := preparePEWriter(src, rsrcData, options)
 	if err != nil {
 		return err
 	}
@@ -270,7 +344,7 @@ func replaceRSRCSection(dst io.Writer, src io.ReadSeeker, rsrcData []byte, reloc
 	return pew.writeEXE(dst)
 }
 
-func preparePEWriter(src io.ReadSeeker, rsrcData []byte, sigHandling authenticodeHandling) (*peWriter, error) {
+func preparePEWriter(src io.ReadSeeker, rsrcData []byte, options exeOptions) (*peWriter, error) {
 	var (
 		pew peWriter
 		err error
@@ -287,7 +361,8 @@ func preparePEWriter(src io.ReadSeeker, rsrcData []byte, sigHandling authenticod
 	}
 
 	if len(pew.h.dirs) > pe.IMAGE_DIRECTORY_ENTRY_SECURITY && pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].VirtualAddress > 0 {
-		switch sigHandling {
+		pew.src.certOffset = int64(pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].VirtualAddress)
+		switch options.authenticodeHandling {
 		case RemoveSignature:
 			entry := pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
 			pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY] = pe.DataDirectory{}
@@ -314,10 +389,33 @@ func preparePEWriter(src io.ReadSeeker, rsrcData []byte, sigHandling authenticod
 		return nil, errors.New(errNoRoomForRSRC)
 	}
 
+	pew.appendRSRC = pew.rsrcHdr == nil
+	if options.reclaimOldRSRC {
+		pew.removeOldRSRCData()
+	}
 	if pew.requiresNewSection() {
-		// Play it safe, abandon the existing .rsrc section and create a new one.
-		pew.rsrcHdr.Name = [8]byte{'o', 'l', 'd', '.', 'r', 's', 'r', 'c'}
-		pew.rsrcHdr = nil
+		// Sections that follow .rsrc cannot be moved, so we relocate .rsrc at the end of the image.
+		pew.abandonRSRC()
+		if options.reclaimOldRSRC {
+			pew.reuseOldRSRC()
+		}
+	} else if options.reclaimOldRSRC && pew.canMoveRSRCBack() {
+		// .rsrc goes back to the address range of an "old.rsrc" section, then its own section can be removed.
+		pew.abandonRSRC()
+		pew.reuseOldRSRC()
+	}
+	if options.reclaimOldRSRC {
+		pew.removeOldRSRCSections()
+	}
+
+	pew.findOverlay()
+	if pew.src.overlayEnd > pew.src.overlayOffset {
+		switch options.overlayHandling {
+		case RemoveOverlay:
+			pew.dropOverlay = true
+		case ErrorIfOverlay:
+			return nil, ErrOverlay
+		}
 	}
 
 	pew.updateHeaders()
@@ -327,7 +425,6 @@ func preparePEWriter(src io.ReadSeeker, rsrcData []byte, sigHandling authenticod
 
 func (pew *peWriter) fillSectionsInfo() error {
 	pew.src.dataOffset = 0xFFFFFFFF
-	pew.src.rsrcEnd = pew.src.fileSize
 
 	for i := range pew.h.sections {
 		if pew.h.sections[i].VirtualAddress == pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE].VirtualAddress {
@@ -335,6 +432,7 @@ func (pew *peWriter) fillSectionsInfo() error {
 				return errors.New(errRSRCTwice)
 			}
 			pew.rsrcHdr = &pew.h.sections[i]
+			pew.src.rsrcOffset = int64(pew.rsrcHdr.PointerToRawData)
 			pew.src.rsrcEnd = int64(pew.roundRaw(pew.rsrcHdr.PointerToRawData + pew.rsrcHdr.SizeOfRawData))
 		}
 		if pew.h.sections[i].VirtualAddress == pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_BASERELOC].VirtualAddress {
@@ -349,7 +447,7 @@ func (pew *peWriter) fillSectionsInfo() error {
 		if pew.h.sections[i].VirtualAddress+pew.h.sections[i].VirtualSize > pew.src.virtEnd {
 			pew.src.virtEnd = pew.h.sections[i].VirtualAddress + pew.h.sections[i].VirtualSize
 		}
-		if pew.h.sections[i].Characteristics&pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0 {
+		if pew.h.sections[i].Characteristics&pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0 || pew.h.sections[i].SizeOfRawData == 0 {
 			// Exclude sections containing uninitialized data from file offset
 			// calculations, as they do not occupy any data in the file.
 			continue
@@ -363,50 +461,263 @@ func (pew *peWriter) fillSectionsInfo() error {
 	}
 	pew.src.virtEnd = pew.roundVirt(pew.src.virtEnd)
 
+	if pew.rsrcHdr == nil {
+		pew.src.rsrcOffset = int64(pew.src.dataEnd)
+		pew.src.rsrcEnd = int64(pew.src.dataEnd)
+	}
+
 	return nil
 }
 
+// findOverlay locates data appended after the last section, excluding the certificate table.
+func (pew *peWriter) findOverlay() {
+	pew.src.overlayOffset = int64(pew.src.dataEnd)
+	if pew.src.rsrcEnd > pew.src.overlayOffset {
+		// The .rsrc section is the last one in the file, and its padding will be rewritten
+		pew.src.overlayOffset = pew.src.rsrcEnd
+	}
+	for _, r := range pew.src.removed {
+		if r.end > pew.src.overlayOffset {
+			pew.src.overlayOffset = r.end
+		}
+	}
+	if pew.src.overlayOffset > pew.src.fileSize {
+		pew.src.overlayOffset = pew.src.fileSize
+	}
+
+	pew.src.overlayEnd = pew.src.fileSize
+	if pew.src.certOffset >= pew.src.overlayOffset && pew.src.certOffset < pew.src.overlayEnd {
+		pew.src.overlayEnd = pew.src.certOffset
+	}
+}
+
 func (pew *peWriter) requiresNewSection() bool {
 	if pew.rsrcHdr == nil {
 		return false
 	}
-	endOfRSRC := pew.roundVirt(pew.rsrcHdr.VirtualAddress + pew.rsrcHdr.VirtualSize)
-	if endOfRSRC >= pew.src.virtEnd {
+	if pew.canShiftSectionsAfterRSRC() {
 		return false
 	}
-	if pew.relocHdr.VirtualAddress == endOfRSRC &&
-		pew.roundVirt(pew.relocHdr.VirtualAddress+pew.relocHdr.VirtualSize) >= pew.src.virtEnd {
+
+	// From here, we should not shift sections after the existing .rsrc section in memory
+	if pew.roundVirt(pew.rsrcHdr.VirtualSize) >= uint32(len(pew.rsrcData)) {
+		// The .rsrc section won't grow, so we only have to ensure it won't shrink too much either
+		pew.rsrcVirtSize = pew.rsrcHdr.VirtualSize
 		return false
 	}
 
-	// From here, we should not shift data after the existing .rsrc section
-	if pew.rsrcHdr.SizeOfRawData >= uint32(len(pew.rsrcData)) {
-		// The .rsrc section won't grow, so we only have to ensure it won't shrink too much either
-		buf := make([]byte, pew.rsrcHdr.SizeOfRawData)
-		copy(buf, pew.rsrcData)
-		pew.rsrcData = buf
+	return true
+}
+
+// canShiftSectionsAfterRSRC tells if every section after .rsrc in memory may be moved.
+//
+// This is true for the base relocation table, which is only referenced in the data directory,
+// and for empty sections left by a previous relocation of .rsrc.
+// Other sections, such as .tls or .pdata, may be referenced from code.
+func (pew *peWriter) canShiftSectionsAfterRSRC() bool {
+	for i := range pew.h.sections {
+		sec := &pew.h.sections[i]
+		if sec.VirtualAddress <= pew.rsrcHdr.VirtualAddress || sec == pew.relocHdr || isOldRSRC(sec) {
+			continue
+		}
 		return false
 	}
+	return true
+}
+
+// abandonRSRC relocates the .rsrc section at the end of the image.
+//
+// The old section is kept as an empty placeholder named "old.rsrc", so the address space remains contiguous,
+// but its data is removed from the file, and sections that follow it in the file are moved back.
+func (pew *peWriter) abandonRSRC() {
+	pew.removeRawData(pew.rsrcHdr, pew.src.rsrcEnd-pew.src.rsrcOffset)
+	pew.rsrcHdr.Name = oldRSRCName
+	pew.rsrcHdr = nil
+	pew.appendRSRC = true
+}
+
+// removeOldRSRCData removes the data of "old.rsrc" sections from the file.
+func (pew *peWriter) removeOldRSRCData() {
+	var secs []*pe.SectionHeader32
+	for i := range pew.h.sections {
+		sec := &pew.h.sections[i]
+		if !isOldRSRC(sec) || sec.SizeOfRawData == 0 || sec.Characteristics&pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0 {
+			continue
+		}
+		r := rawRange{
+			start: int64(sec.PointerToRawData),
+			end:   int64(pew.roundRaw(sec.PointerToRawData + sec.SizeOfRawData)),
+		}
+		if r.end > pew.src.fileSize {
+			r.end = pew.src.fileSize
+		}
+		secs = append(secs, sec)
+		pew.src.removed = append(pew.src.removed, r)
+	}
+	for i, sec := range secs {
+		pew.removeRawData(sec, pew.src.removed[i].end-pew.src.removed[i].start)
+	}
+}
+
+// removeRawData turns a section into an empty placeholder, which does not occupy any space in the file.
+func (pew *peWriter) removeRawData(sec *pe.SectionHeader32, size int64) {
+	for i := range pew.h.sections {
+		if pew.h.sections[i].SizeOfRawData > 0 && pew.h.sections[i].PointerToRawData > sec.PointerToRawData {
+			pew.h.sections[i].PointerToRawData -= uint32(size)
+		}
+	}
+	pew.h.opt.setSizeOfInitializedData(pew.h.opt.getSizeOfInitializedData() - sec.SizeOfRawData)
+
+	*sec = pe.SectionHeader32{
+		Name:            sec.Name,
+		VirtualSize:     sec.VirtualSize,
+		VirtualAddress:  sec.VirtualAddress,
+		Characteristics: _IMAGE_SCN_MEM_READ | pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA,
+	}
+}
+
+// reuseOldRSRC puts the new .rsrc section in place of an empty "old.rsrc" section, if one is large enough.
+//
+// The data is still added after the last section in the file.
+func (pew *peWriter) reuseOldRSRC() {
+	sec := pew.findOldRSRC()
+	if sec == nil {
+		return
+	}
+	pew.rsrcVirtSize = sec.VirtualSize
+	sec.Name = rsrcName
+	sec.PointerToRawData = pew.roundRaw(pew.dataEnd())
+	sec.Characteristics = _IMAGE_SCN_MEM_READ | _IMAGE_SCN_CNT_INITIALIZED_DATA
+	pew.rsrcHdr = sec
+}
+
+// findOldRSRC returns the empty "old.rsrc" section with the lowest address that can hold the new .rsrc data, or nil.
+func (pew *peWriter) findOldRSRC() *pe.SectionHeader32 {
+	var found *pe.SectionHeader32
+	for i := range pew.h.sections {
+		sec := &pew.h.sections[i]
+		if !isOldRSRC(sec) || sec.SizeOfRawData > 0 || pew.roundVirt(sec.VirtualSize) < uint32(len(pew.rsrcData)) {
+			continue
+		}
+		if found == nil || sec.VirtualAddress < found.VirtualAddress {
+			found = sec
+		}
+	}
+	return found
+}
+
+// canMoveRSRCBack tells if the existing .rsrc section, which is followed in memory by movable sections only,
+// can be replaced by an "old.rsrc" section that precedes it and cannot be removed.
+func (pew *peWriter) canMoveRSRCBack() bool {
+	if pew.rsrcHdr == nil || !pew.canShiftSectionsAfterRSRC() {
+		return false
+	}
+	old := pew.findOldRSRC()
+	return old != nil && old.VirtualAddress < pew.rsrcHdr.VirtualAddress && !pew.canRemoveSection(old)
+}
+
+// removeOldRSRCSections removes empty "old.rsrc" sections that are followed in memory by movable sections only.
+func (pew *peWriter) removeOldRSRCSections() {
+	for i := len(pew.h.sections) - 1; i >= 0; i-- {
+		if pew.canRemoveSection(&pew.h.sections[i]) {
+			pew.removeSection(i)
+		}
+	}
+}
 
+func (pew *peWriter) canRemoveSection(sec *pe.SectionHeader32) bool {
+	if !isOldRSRC(sec) || sec.SizeOfRawData > 0 {
+		return false
+	}
+	for j := range pew.h.sections {
+		next := &pew.h.sections[j]
+		if next.VirtualAddress <= sec.VirtualAddress || next == pew.rsrcHdr || next == pew.relocHdr || isOldRSRC(next) {
+			continue
+		}
+		return false
+	}
 	return true
 }
 
+// removeSection removes a section header, and moves back every section that follows it in memory.
+func (pew *peWriter) removeSection(i int) {
+	sec := pew.h.sections[i]
+	delta := pew.roundVirt(sec.VirtualSize)
+
+	for j := range pew.h.sections {
+		if pew.h.sections[j].VirtualAddress > sec.VirtualAddress {
+			pew.h.sections[j].VirtualAddress -= delta
+		}
+	}
+	for j := range pew.h.dirs {
+		if j != pe.IMAGE_DIRECTORY_ENTRY_SECURITY && pew.h.dirs[j].VirtualAddress > sec.VirtualAddress {
+			pew.h.dirs[j].VirtualAddress -= delta
+		}
+	}
+	pew.src.virtEnd -= delta
+
+	// Section headers are moved, so pointers to them must be updated
+	index := func(p *pe.SectionHeader32) int {
+		for j := range pew.h.sections {
+			if p == &pew.h.sections[j] {
+				return j
+			}
+		}
+		return -1
+	}
+	rsrc, reloc := index(pew.rsrcHdr), index(pew.relocHdr)
+	pew.h.sections = append(pew.h.sections[:i], pew.h.sections[i+1:]...)
+	pew.rsrcHdr = pew.sectionAt(rsrc, i)
+	pew.relocHdr = pew.sectionAt(reloc, i)
+
+	pew.h.file.NumberOfSections--
+	pew.h.length -= sizeOfSectionHeader
+}
+
+// sectionAt returns a pointer to the section header that was at index j before removing the one at index i.
+func (pew *peWriter) sectionAt(j int, i int) *pe.SectionHeader32 {
+	switch {
+	case j < 0:
+		return nil
+	case j > i:
+		return &pew.h.sections[j-1]
+	}
+	return &pew.h.sections[j]
+}
+
+var (
+	rsrcName    = [8]byte{'.', 'r', 's', 'r', 'c'}
+	oldRSRCName = [8]byte{'o', 'l', 'd', '.', 'r', 's', 'r', 'c'}
+)
+
+// isOldRSRC tells if a section was left by a relocation of the .rsrc section.
+//
+// Such a section is not referenced by anything, so it may be moved or removed.
+func isOldRSRC(sec *pe.SectionHeader32) bool {
+	return sec.Name == oldRSRCName
+}
+
 func (pew *peWriter) updateHeaders() {
 	var (
 		rsrcLen     = uint32(len(pew.rsrcData))
+		virtSize    = rsrcLen
 		lastSection *pe.SectionHeader32
 		oldSize     uint32
 		virtDelta   uint32
 	)
+	if virtSize < pew.rsrcVirtSize {
+		// Only the data is written to the file, the loader fills the rest of the section with zeros
+		virtSize = pew.rsrcVirtSize
+	}
 
 	if pew.rsrcHdr == nil {
 		// Add .rsrc section
 		pew.h.sections = append(pew.h.sections, pe.SectionHeader32{
-			Name:             [8]uint8{'.', 'r', 's', 'r', 'c'},
+			Name:             rsrcName,
 			VirtualSize:      rsrcLen,
 			VirtualAddress:   pew.roundVirt(pew.src.virtEnd),
 			SizeOfRawData:    pew.roundRaw(uint32(len(pew.rsrcData))),
-			PointerToRawData: pew.roundRaw(pew.src.dataEnd),
+			PointerToRawData: pew.roundRaw(pew.dataEnd()),
 			Characteristics:  _IMAGE_SCN_MEM_READ | _IMAGE_SCN_CNT_INITIALIZED_DATA,
 		})
 		pew.rsrcHdr = &pew.h.sections[len(pew.h.sections)-1]
@@ -416,9 +727,9 @@ func (pew *peWriter) updateHeaders() {
 		pew.h.opt.setSizeOfInitializedData(pew.h.opt.getSizeOfInitializedData() + rsrcLen)
 	} else {
 		oldSize = pew.rsrcHdr.SizeOfRawData
-		virtDelta = pew.roundVirt(rsrcLen) - pew.roundVirt(pew.rsrcHdr.VirtualSize)
+		virtDelta = pew.roundVirt(virtSize) - pew.roundVirt(pew.rsrcHdr.VirtualSize)
 		rawDelta := pew.roundRaw(rsrcLen) - pew.roundRaw(pew.rsrcHdr.SizeOfRawData)
-		pew.rsrcHdr.VirtualSize = rsrcLen
+		pew.rsrcHdr.VirtualSize = virtSize
 		pew.rsrcHdr.SizeOfRawData = pew.roundRaw(rsrcLen)
 		lastSection = pew.rsrcHdr
 		for i := range pew.h.sections {
@@ -434,8 +745,11 @@ func (pew *peWriter) updateHeaders() {
 		}
 	}
 
-	if pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].VirtualAddress >= pew.src.dataEnd {
-		pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].VirtualAddress += lastSection.PointerToRawData + lastSection.SizeOfRawData - pew.src.dataEnd
+	if sec := &pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]; sec.VirtualAddress > 0 && int64(sec.VirtualAddress) >= pew.src.overlayOffset {
+		sec.VirtualAddress = uint32(int64(sec.VirtualAddress) - pew.src.overlayOffset + int64(pew.dataEnd()))
+		if pew.dropOverlay {
+			sec.VirtualAddress -= uint32(pew.src.overlayEnd - pew.src.overlayOffset)
+		}
 	}
 
 	pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE].VirtualAddress = pew.rsrcHdr.VirtualAddress
@@ -451,6 +765,20 @@ func (pew *peWriter) updateHeaders() {
 	pew.h.opt.setSizeOfInitializedData(pew.h.opt.getSizeOfInitializedData() - oldSize + pew.rsrcHdr.SizeOfRawData)
 }
 
+// dataEnd returns the end of the last section's data in the new file.
+func (pew *peWriter) dataEnd() uint32 {
+	var end uint32
+	for i := range pew.h.sections {
+		if pew.h.sections[i].Characteristics&pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA != 0 || pew.h.sections[i].SizeOfRawData == 0 {
+			continue
+		}
+		if pew.h.sections[i].PointerToRawData+pew.h.sections[i].SizeOfRawData > end {
+			end = pew.h.sections[i].PointerToRawData + pew.h.sections[i].SizeOfRawData
+		}
+	}
+	return end
+}
+
 func (pew *peWriter) roundRaw(p uint32) uint32 {
 	a := pew.h.opt.getFileAlignment()
 	x := p + a - 1
@@ -512,48 +840,154 @@ func (pew *peWriter) writeEXE(w io.Writer) error {
 	if err != nil {
 		return err
 	}
-	_, err = pew.src.r.Seek(int64(pew.src.dataOffset), io.SeekStart)
+	// Sections, skipping the old .rsrc section and removed data
+	end := int64(pew.src.dataOffset)
+	for _, r := range pew.skippedRanges() {
+		err = pew.copySource(w, end, r.start)
+		if err != nil {
+			return err
+		}
+		if r.start == pew.src.rsrcOffset && !pew.appendRSRC {
+			// .rsrc
+			err = pew.writeRSRC(w)
+			if err != nil {
+				return err
+			}
+		}
+		end = r.end
+	}
+	err = pew.copySource(w, end, pew.src.overlayOffset)
 	if err != nil {
 		return err
 	}
 
-	// Sections before .rsrc
-	end := int64(pew.src.dataEnd)
-	if int64(pew.rsrcHdr.PointerToRawData) < end {
-		end = int64(pew.rsrcHdr.PointerToRawData)
+	// New .rsrc, after the last section
+	if pew.appendRSRC {
+		end = pew.src.overlayOffset
+		for _, r := range pew.skippedRanges() {
+			end -= r.end - r.start
+		}
+		err = writeBlank(w, int64(pew.rsrcHdr.PointerToRawData)-end)
+		if err != nil {
+			return err
+		}
+		err = pew.writeRSRC(w)
+		if err != nil {
+			return err
+		}
 	}
-	_, err = io.CopyN(w, pew.src.r, end-int64(pew.src.dataOffset))
+
+	// Overlay
+	if !pew.dropOverlay {
+		err = pew.copySource(w, pew.src.overlayOffset, pew.src.overlayEnd)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Certificate table
+	return pew.copySource(w, pew.src.overlayEnd, pew.src.fileSize-pew.src.sigSize)
+}
+
+// skippedRanges returns the ranges of the source file that are not copied as is, sorted by offset.
+func (pew *peWriter) skippedRanges() []rawRange {
+	ranges := append([]rawRange{{pew.src.rsrcOffset, pew.src.rsrcEnd}}, pew.src.removed...)
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start < ranges[j].start
+	})
+	return ranges
+}
+
+// writeRSRC writes the new .rsrc section, padded to its raw size.
+func (pew *peWriter) writeRSRC(w io.Writer) error {
+	_, err := w.Write(pew.rsrcData)
 	if err != nil {
 		return err
 	}
-	err = writeBlank(w, int64(pew.rsrcHdr.PointerToRawData)-end)
-	if err != nil {
+	return writeBlank(w, int64(pew.rsrcHdr.SizeOfRawData)-int64(len(pew.rsrcData)))
+}
+
+// copySource copies the source file from offset start to offset end.
+func (pew *peWriter) copySource(w io.Writer, start int64, end int64) error {
+	_, err := pew.src.r.Seek(start, io.SeekStart)
+	if err != nil || end <= start {
 		return err
 	}
+	_, err = io.CopyN(w, pew.src.r, end-start)
+	return err
+}
 
-	// .rsrc
-	_, err = w.Write(pew.rsrcData)
+// patchFile calls write to produce a new version of a file, and safely replaces the file with it.
+//
+// If path is a symbolic link, the file it points to is replaced, and the link is kept.
+func patchFile(path string, write func(dst io.Writer, src io.ReadSeeker) error) (err error) {
+	path, err = filepath.EvalSymlinks(path)
 	if err != nil {
 		return err
 	}
-	err = writeBlank(w, int64(pew.rsrcHdr.SizeOfRawData)-int64(len(pew.rsrcData)))
+
+	src, err := os.Open(path)
 	if err != nil {
 		return err
 	}
+	defer src.Close()
 
-	// Remainder
-	_, err = pew.src.r.Seek(pew.src.rsrcEnd, io.SeekStart)
+	stat, err := src.Stat()
 	if err != nil {
 		return err
 	}
-	_, err = io.CopyN(w, pew.src.r, pew.src.fileSize-pew.src.sigSize-pew.src.rsrcEnd)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp, src); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(stat.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
 
+	// Windows won't replace a file that is still open
+	src.Close()
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// The file has already been replaced, so syncing its directory is only a best effort,
+	// and failing to do so must not be reported as if the file was left untouched
+	syncDir(filepath.Dir(path))
 	return nil
 }
 
+// syncDir commits a directory's entries to disk, so that a rename survives a crash.
+//
+// Windows cannot sync a directory, but NTFS journals renames anyway.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
 func writeBlank(w io.Writer, length int64) error {
 	if length <= 0 {
 		return nil
@@ -2,6 +2,8 @@ package winres
 
 import (
 	"bytes"
+	"debug/pe"
+	"encoding/binary"
 	"errors"
 	"image"
 	"image/png"
@@ -232,3 +234,98 @@ func (w *badWriter) Write(b []byte) (n int, err error) {
 func isExpectedWriteErr(err error) bool {
 	return err != nil && err.Error() == errWrite
 }
+
+type testSection struct {
+	name     string
+	virtSize uint32 // defaults to len(data)
+	data     []byte
+	dir      int // index of the data directory pointing to this section, or 0
+}
+
+const (
+	testFileAlignment    = 0x200
+	testSectionAlignment = 0x1000
+	testSizeOfHeaders    = 0x400
+)
+
+// makeTestEXE builds a minimal PE32+ image with sections in the same order in the file and in memory.
+func makeTestEXE(sections []testSection, overlay []byte) []byte {
+	round := func(x, a uint32) uint32 { return (x + a - 1) &^ (a - 1) }
+
+	var (
+		hdrs = make([]pe.SectionHeader32, len(sections))
+		dirs = make([]pe.DataDirectory, 16)
+		virt = uint32(testSectionAlignment)
+		raw  = uint32(testSizeOfHeaders)
+	)
+	for i, s := range sections {
+		copy(hdrs[i].Name[:], s.name)
+		hdrs[i].VirtualSize = s.virtSize
+		if hdrs[i].VirtualSize == 0 {
+			hdrs[i].VirtualSize = uint32(len(s.data))
+		}
+		hdrs[i].VirtualAddress = virt
+		hdrs[i].SizeOfRawData = round(uint32(len(s.data)), testFileAlignment)
+		hdrs[i].PointerToRawData = raw
+		hdrs[i].Characteristics = _IMAGE_SCN_MEM_READ | _IMAGE_SCN_CNT_INITIALIZED_DATA
+		if s.dir > 0 {
+			dirs[s.dir] = pe.DataDirectory{VirtualAddress: virt, Size: hdrs[i].VirtualSize}
+		}
+		virt += round(hdrs[i].VirtualSize, testSectionAlignment)
+		raw += hdrs[i].SizeOfRawData
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write([]byte{'M', 'Z', 0x3C: 0x40, 0x3F: 0})
+	buf.Write([]byte{'P', 'E', 0, 0})
+	binary.Write(buf, binary.LittleEndian, pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		NumberOfSections:     uint16(len(sections)),
+		SizeOfOptionalHeader: uint16(binary.Size(peOptionalHeader64{}) + binary.Size(dirs)),
+		Characteristics:      pe.IMAGE_FILE_EXECUTABLE_IMAGE | pe.IMAGE_FILE_LARGE_ADDRESS_AWARE,
+	})
+	binary.Write(buf, binary.LittleEndian, peOptionalHeader64{
+		Magic:               0x20B,
+		SectionAlignment:    testSectionAlignment,
+		FileAlignment:       testFileAlignment,
+		SizeOfImage:         virt,
+		SizeOfHeaders:       testSizeOfHeaders,
+		NumberOfRvaAndSizes: uint32(len(dirs)),
+	})
+	binary.Write(buf, binary.LittleEndian, dirs)
+	binary.Write(buf, binary.LittleEndian, hdrs)
+	buf.Write(make([]byte, testSizeOfHeaders-buf.Len()))
+	for i, s := range sections {
+		buf.Write(s.data)
+		buf.Write(make([]byte, int(hdrs[i].SizeOfRawData)-len(s.data)))
+	}
+	buf.Write(overlay)
+
+	return buf.Bytes()
+}
+
+// testSectionData returns recognizable section content.
+func testSectionData(length int, seed byte) []byte {
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = seed + byte(i)
+	}
+	return b
+}
+
+// sectionData returns the raw content of a section found in a PE image, by name.
+func sectionData(t *testing.T, exe []byte, name string) []byte {
+	f, err := pe.NewFile(bytes.NewReader(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := f.Section(name)
+	if s == nil {
+		t.Fatal("section not found:", name)
+	}
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
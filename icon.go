@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
 	"image/png"
 	"io"
+	"os"
+	"path/filepath"
 	"sort"
 
 	"github.com/nfnt/resize"
@@ -17,21 +20,124 @@ import (
 // Icon describes a Windows icon.
 //
 // This structure must only be created by constructors:
-// NewIconFromImages, NewIconFromResizedImage, LoadICO
+// NewIconFromImages, NewIconFromResizedImage, NewIconFromSizedSources, IconFromCursor, LoadICO
 type Icon struct {
 	images []iconImage
 }
 
 var DefaultIconSizes = []int{256, 64, 48, 32, 16}
 
+type iconFormat int
+
+const (
+	// IconPNG stores images as 32bpp PNG, this is the default format
+	IconPNG iconFormat = iota
+	// IconBMP32 stores images as 32bpp DIB, with an AND mask
+	IconBMP32
+	// IconBMP8 stores images as 8bpp DIB, with a generated palette and an AND mask
+	IconBMP8
+	// IconBMP4 stores images as 4bpp DIB, with a generated palette and an AND mask
+	IconBMP4
+)
+
+type resampling int
+
+const (
+	// ResampleLanczos2 is the default resampling filter, it is sharp with few artifacts
+	ResampleLanczos2 resampling = iota
+	// ResampleLanczos3 is sharper than Lanczos2, but it may produce more ringing artifacts
+	ResampleLanczos3
+	// ResampleCatmullRom is a bicubic filter, smoother than Lanczos
+	ResampleCatmullRom
+	// ResampleBilinear is a fast and blurry filter
+	ResampleBilinear
+	// ResampleNearestNeighbor keeps hard edges, it is meant for pixel art
+	ResampleNearestNeighbor
+)
+
+type iconOptions struct {
+	format     iconFormat
+	formats    map[int]iconFormat
+	resampling resampling
+	sharpening float64
+	optimize   bool
+}
+
+type iconOption func(opt *iconOptions)
+
+// WithIconFormat selects how images are encoded in an icon.
+//
+// The format applies to the given sizes only, or to every size if none is given.
+//
+// PNG is the most compact format, but some old shells and clients only support DIB, especially for small sizes.
+func WithIconFormat(format iconFormat, sizes ...int) iconOption {
+	return func(opt *iconOptions) {
+		if len(sizes) == 0 {
+			opt.format = format
+			opt.formats = nil
+			return
+		}
+		if opt.formats == nil {
+			opt.formats = make(map[int]iconFormat)
+		}
+		for _, s := range sizes {
+			opt.formats[s] = format
+		}
+	}
+}
+
+// WithResampling selects the filter used to resize images.
+func WithResampling(filter resampling) iconOption {
+	return func(opt *iconOptions) {
+		opt.resampling = filter
+	}
+}
+
+// WithSharpening applies an unsharp mask to resized images.
+//
+// amount is the strength of the effect, 0.5 is a good start.
+// The mask is a 3x3 gaussian blur, which suits small icons.
+func WithSharpening(amount float64) iconOption {
+	return func(opt *iconOptions) {
+		opt.sharpening = amount
+	}
+}
+
+// WithPNGOptimization makes PNG images smaller, at the expense of encoding time.
+//
+// Images are compressed at the best level, and they are stored with a palette when they have no more than 256 colors.
+// See also Icon.OptimizePNG.
+func WithPNGOptimization() iconOption {
+	return func(opt *iconOptions) {
+		opt.optimize = true
+	}
+}
+
+func makeIconOptions(opt []iconOption) iconOptions {
+	options := iconOptions{}
+	for _, o := range opt {
+		o(&options)
+	}
+	return options
+}
+
+// formatFor returns the format of an image of a given size.
+func (options *iconOptions) formatFor(size int) iconFormat {
+	if f, ok := options.formats[size]; ok {
+		return f
+	}
+	return options.format
+}
+
 // NewIconFromImages makes an icon from a list of images.
 //
-// This converts every image to 32bpp PNG.
-func NewIconFromImages(images []image.Image) (*Icon, error) {
+// This converts every image to 32bpp PNG, unless WithIconFormat is used.
+func NewIconFromImages(images []image.Image, opt ...iconOption) (*Icon, error) {
 	icon := Icon{}
+	options := makeIconOptions(opt)
 
 	for _, img := range images {
-		if err := icon.addImage(img); err != nil {
+		if err := icon.addImage(img, &options); err != nil {
 			return nil, err
 		}
 	}
@@ -42,7 +148,9 @@ func NewIconFromImages(images []image.Image) (*Icon, error) {
 // NewIconFromResizedImage makes an icon from a single Image by resizing it.
 //
 // If sizes is nil, the icon will be resized to: 256px, 64px, 48px, 32px, 16px.
-func NewIconFromResizedImage(img image.Image, sizes []int) (*Icon, error) {
+//
+// It accepts the same options as NewIconFromImages, plus WithResampling and WithSharpening.
+func NewIconFromResizedImage(img image.Image, sizes []int, opt ...iconOption) (*Icon, error) {
 	if sizes == nil {
 		sizes = DefaultIconSizes
 	}
@@ -51,8 +159,9 @@ func NewIconFromResizedImage(img image.Image, sizes []int) (*Icon, error) {
 	}
 
 	icon := Icon{}
+	options := makeIconOptions(opt)
 	for _, s := range sizes {
-		if err := icon.addImage(resizeImage(img, s)); err != nil {
+		if err := icon.addImage(resizeImage(img, s, &options), &options); err != nil {
 			return nil, err
 		}
 	}
@@ -60,6 +169,88 @@ func NewIconFromResizedImage(img image.Image, sizes []int) (*Icon, error) {
 	return &icon, nil
 }
 
+// NewIconFromSizedSources makes an icon from images designed for specific sizes.
+//
+// sources maps a size in pixels to the image that should be used for that size.
+// An image that does not fit exactly this size is resized.
+//
+// If fallback is not nil, it is resized to every size of DefaultIconSizes that is missing from sources.
+//
+// It accepts the same options as NewIconFromResizedImage.
+func NewIconFromSizedSources(sources map[int]image.Image, fallback image.Image, opt ...iconOption) (*Icon, error) {
+	images := make(map[int]image.Image)
+	if fallback != nil {
+		for _, s := range DefaultIconSizes {
+			images[s] = fallback
+		}
+	}
+	for s, img := range sources {
+		images[s] = img
+	}
+	if len(images) > 30 {
+		return nil, errors.New(errTooManyIconSizes)
+	}
+
+	sizes := make([]int, 0, len(images))
+	for s := range images {
+		if s < 1 || s > 256 || images[s] == nil {
+			return nil, errors.New(errInvalidImageDimensions)
+		}
+		sizes = append(sizes, s)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+
+	icon := Icon{}
+	options := makeIconOptions(opt)
+	for _, s := range sizes {
+		img := images[s]
+		if sz := img.Bounds().Size(); sz.X != s || sz.Y != s {
+			img = resizeImage(img, s, &options)
+		}
+		if err := icon.addImage(img, &options); err != nil {
+			return nil, err
+		}
+	}
+
+	return &icon, nil
+}
+
+// IconFromCursor makes an icon from the images of a cursor, without re-encoding them.
+//
+// Hot spots are dropped.
+func IconFromCursor(cursor *Cursor) (*Icon, error) {
+	cursor.order()
+
+	icon := &Icon{}
+	for i := range cursor.images {
+		img := &cursor.images[i]
+		hdr, err := readIconImageHeader(img.image)
+		if err != nil {
+			return nil, err
+		}
+		if img.info.Width > 256 || img.info.Height > 256 {
+			return nil, errors.New(errImageTooBig)
+		}
+		var colorCount uint8
+		if hdr.bitCount < 8 {
+			colorCount = 1 << hdr.bitCount
+		}
+		icon.images = append(icon.images, iconImage{
+			info: iconInfo{
+				Width:      uint8(img.info.Width),  // 0 means 256
+				Height:     uint8(img.info.Height), // 0 means 256
+				ColorCount: colorCount,
+				Planes:     1,
+				BitCount:   uint16(hdr.bitCount),
+				BytesInRes: uint32(len(img.image)),
+			},
+			image: img.image,
+		})
+	}
+
+	return icon, nil
+}
+
 // LoadICO loads an ICO file and returns an icon, ready to embed in a resource set.
 func LoadICO(ico io.ReadSeeker) (*Icon, error) {
 	hdr := iconDirHeader{}
@@ -98,6 +289,67 @@ func LoadICO(ico io.ReadSeeker) (*Icon, error) {
 	return icon, nil
 }
 
+// LoadICOStrict is like LoadICO, but it also checks that the icon is valid, see Icon.Validate.
+func LoadICOStrict(ico io.ReadSeeker) (*Icon, error) {
+	icon, err := LoadICO(ico)
+	if err != nil {
+		return nil, err
+	}
+	if err = icon.Validate(); err != nil {
+		return nil, err
+	}
+	return icon, nil
+}
+
+// Validate checks that the directory entries of the icon match the actual images.
+//
+// Each entry must declare the dimensions, bit count and length of its image. A dimension of 0 means 256 pixels.
+// Images must fit in 256x256, and two entries must not have the same dimensions and bit count.
+//
+// Windows trusts the directory when it picks an image, so a mismatch may result in a garbled icon.
+func (icon *Icon) Validate() error {
+	seen := make(map[iconImageHeader]bool)
+	for i := range icon.images {
+		img := &icon.images[i]
+		hdr, err := validateImage(img.image, int(img.info.Width-1)+1, int(img.info.Height-1)+1, int(img.info.BitCount))
+		if err == nil && img.info.BytesInRes != uint32(len(img.image)) {
+			err = errors.New(errLengthMismatch)
+		}
+		if err == nil && seen[hdr] {
+			err = errors.New(errDuplicateImage)
+		}
+		if err != nil {
+			return fmt.Errorf("image %d: %w", i, err)
+		}
+		seen[hdr] = true
+	}
+	return nil
+}
+
+// validateImage checks that an image stored in an icon or a cursor matches its declared dimensions and bit count.
+//
+// A PNG image's bit count is not checked, and a declared bit count of 0 is considered unspecified.
+func validateImage(data []byte, width, height, bitCount int) (iconImageHeader, error) {
+	hdr, err := readIconImageHeader(data)
+	if err != nil {
+		return hdr, err
+	}
+	if hdr.width <= 0 || hdr.height <= 0 {
+		return hdr, errors.New(errInvalidImageDimensions)
+	}
+	if hdr.width > 256 || hdr.height > 256 {
+		return hdr, errors.New(errImageTooBig)
+	}
+	if hdr.width != width || hdr.height != height {
+		return hdr, errors.New(errDimensionsMismatch)
+	}
+	if !hdr.png && bitCount != 0 && hdr.bitCount != bitCount {
+		return hdr, errors.New(errBitCountMismatch)
+	}
+	hdr.png = false
+	return hdr, nil
+}
+
 // SaveICO saves an icon as an ICO file.
 func (icon *Icon) SaveICO(ico io.Writer) error {
 	err := binary.Write(ico, binary.LittleEndian, &iconDirHeader{
@@ -137,6 +389,286 @@ func (icon *Icon) SaveICO(ico io.Writer) error {
 	return nil
 }
 
+// Images decodes every image of the icon.
+//
+// Images are returned in the same order as Entries.
+func (icon *Icon) Images() ([]image.Image, error) {
+	icon.order()
+	images := make([]image.Image, len(icon.images))
+	for i := range icon.images {
+		img, err := decodeIconImage(icon.images[i].image)
+		if err != nil {
+			return nil, err
+		}
+		images[i] = img
+	}
+	return images, nil
+}
+
+// OptimizePNG re-encodes the PNG images of the icon to make them smaller, as WithPNGOptimization does.
+//
+// Ancillary chunks, such as text or color profiles, are removed.
+// When re-encoding does not make an image smaller, its original image data is kept.
+// DIB images are never modified.
+func (icon *Icon) OptimizePNG() error {
+	for i := range icon.images {
+		if !bytes.HasPrefix(icon.images[i].image, pngSignature) {
+			continue
+		}
+		img, err := png.Decode(bytes.NewReader(icon.images[i].image))
+		if err != nil {
+			return err
+		}
+		data, err := encodeOptimizedPNG(img)
+		if err != nil {
+			return err
+		}
+		if stripped := stripPNG(icon.images[i].image); len(stripped) <= len(data) {
+			data = stripped
+		}
+		icon.images[i].image = data
+		icon.images[i].info.BytesInRes = uint32(len(data))
+	}
+	return nil
+}
+
+// stripPNG removes ancillary chunks from a valid PNG file, except tRNS.
+//
+// Chunks are copied as is, so the image data does not need to be re-encoded.
+func stripPNG(data []byte) []byte {
+	stripped := append([]byte{}, pngSignature...)
+	for pos := len(pngSignature); pos+12 <= len(data); {
+		// A chunk is made of a 4 bytes length, a 4 bytes type, the data, and a 4 bytes CRC
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			break
+		}
+		switch string(data[pos+4 : pos+8]) {
+		case "IHDR", "PLTE", "tRNS", "IDAT", "IEND":
+			stripped = append(stripped, data[pos:end]...)
+		}
+		pos = end
+	}
+	return stripped
+}
+
+// encodeOptimizedPNG encodes an image as a PNG file, with the best compression,
+// and with a palette when it is smaller.
+func encodeOptimizedPNG(img image.Image) ([]byte, error) {
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	buf := &bytes.Buffer{}
+	if err := enc.Encode(buf, img); err != nil {
+		return nil, err
+	}
+
+	if p := toPaletted(img); p != nil {
+		pbuf := &bytes.Buffer{}
+		if err := enc.Encode(pbuf, p); err != nil {
+			return nil, err
+		}
+		if pbuf.Len() < buf.Len() {
+			return pbuf.Bytes(), nil
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// IconEntry describes an image of an icon.
+type IconEntry struct {
+	Width    int
+	Height   int
+	BitCount int
+	PNG      bool // The image is a PNG file, else it is a DIB
+	Size     int  // Size of the image data, in bytes
+}
+
+// Entries lists the images of the icon, by descending quality and size.
+//
+// Indexes in this list can be passed to RemoveEntry and ReplaceEntry.
+func (icon *Icon) Entries() []IconEntry {
+	icon.order()
+	entries := make([]IconEntry, len(icon.images))
+	for i := range icon.images {
+		entries[i] = IconEntry{
+			Width:    int(icon.images[i].info.Width-1) + 1,
+			Height:   int(icon.images[i].info.Height-1) + 1,
+			BitCount: int(icon.images[i].info.BitCount),
+			PNG:      bytes.HasPrefix(icon.images[i].image, pngSignature),
+			Size:     len(icon.images[i].image),
+		}
+	}
+	return entries
+}
+
+// AddImage adds an image to the icon, without modifying the other images.
+//
+// It accepts the same options as NewIconFromImages.
+func (icon *Icon) AddImage(img image.Image, opt ...iconOption) error {
+	options := makeIconOptions(opt)
+	if err := icon.addImage(img, &options); err != nil {
+		return err
+	}
+	icon.order()
+	return nil
+}
+
+// RemoveEntry removes the image at index i of Entries.
+func (icon *Icon) RemoveEntry(i int) error {
+	icon.order()
+	if i < 0 || i >= len(icon.images) {
+		return errors.New(errEntryIndexOutOfRange)
+	}
+	icon.images = append(icon.images[:i], icon.images[i+1:]...)
+	return nil
+}
+
+// ReplaceEntry replaces the image at index i of Entries with a new image.
+//
+// The new image does not have to be the same size. It accepts the same options as NewIconFromImages.
+func (icon *Icon) ReplaceEntry(i int, img image.Image, opt ...iconOption) error {
+	icon.order()
+	if i < 0 || i >= len(icon.images) {
+		return errors.New(errEntryIndexOutOfRange)
+	}
+	replacement := Icon{}
+	options := makeIconOptions(opt)
+	if err := replacement.addImage(img, &options); err != nil {
+		return err
+	}
+	icon.images[i] = replacement.images[0]
+	icon.order()
+	return nil
+}
+
+// Merge adds the images of another icon to this icon.
+//
+// Images of other replace those that have the same dimensions and bit count.
+func (icon *Icon) Merge(other *Icon) {
+	for _, img := range other.images {
+		replaced := false
+		for i := range icon.images {
+			if icon.images[i].info.Width == img.info.Width &&
+				icon.images[i].info.Height == img.info.Height &&
+				icon.images[i].info.BitCount == img.info.BitCount {
+				icon.images[i] = img
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			icon.images = append(icon.images, img)
+		}
+	}
+	icon.order()
+}
+
+// SavePNGs saves every image of the icon as a PNG file named after its dimensions, such as "32x32.png".
+//
+// When several images have the same dimensions, only the best one is saved.
+// PNG images are saved as is, DIB images are converted.
+func (icon *Icon) SavePNGs(dir string) error {
+	frames, err := icon.pngFrames()
+	if err != nil {
+		return err
+	}
+	for _, f := range frames {
+		err = os.WriteFile(filepath.Join(dir, fmt.Sprintf("%dx%d.png", f.width, f.height)), f.data, 0666)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveICNS saves the icon as a macOS ICNS file.
+//
+// ICNS only supports some sizes: 16, 32, 64, 128 and 256 pixels.
+// Images of other sizes are ignored, and there must be at least one image of a supported size.
+// Images are stored as PNG, which requires macOS 10.7.
+func (icon *Icon) SaveICNS(w io.Writer) error {
+	frames, err := icon.pngFrames()
+	if err != nil {
+		return err
+	}
+
+	var (
+		body = &bytes.Buffer{}
+		hdr  = func(osType string, length int) {
+			body.WriteString(osType)
+			binary.Write(body, binary.BigEndian, uint32(length+8))
+		}
+	)
+	for _, f := range frames {
+		if f.width != f.height {
+			continue
+		}
+		for _, osType := range icnsTypes[f.width] {
+			hdr(osType, len(f.data))
+			body.Write(f.data)
+		}
+	}
+	if body.Len() == 0 {
+		return errors.New(errNoICNSSize)
+	}
+
+	_, err = w.Write([]byte("icns"))
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.BigEndian, uint32(body.Len()+8))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body.Bytes())
+	return err
+}
+
+// icnsTypes lists the PNG element types of an ICNS file for each size, including retina (@2x) types.
+var icnsTypes = map[int][]string{
+	16:  {"icp4"},
+	32:  {"icp5", "ic11"},
+	64:  {"icp6", "ic12"},
+	128: {"ic07"},
+	256: {"ic08", "ic13"},
+}
+
+type pngFrame struct {
+	width  int
+	height int
+	data   []byte
+}
+
+// pngFrames returns the best image for each dimension, in PNG format.
+func (icon *Icon) pngFrames() ([]pngFrame, error) {
+	var (
+		frames []pngFrame
+		seen   = make(map[image.Point]bool)
+	)
+	for i, e := range icon.Entries() {
+		dim := image.Point{X: e.Width, Y: e.Height}
+		if seen[dim] {
+			continue
+		}
+		seen[dim] = true
+
+		data := icon.images[i].image
+		if !e.PNG {
+			img, err := decodeDIB(data)
+			if err != nil {
+				return nil, err
+			}
+			buf := &bytes.Buffer{}
+			if err = pngEncode(buf, img); err != nil {
+				return nil, err
+			}
+			data = buf.Bytes()
+		}
+		frames = append(frames, pngFrame{width: e.Width, height: e.Height, data: data})
+	}
+	return frames, nil
+}
+
 // SetIcon adds the icon to the resource set.
 //
 // The first icon will be the application's icon, as shown in Windows Explorer.
@@ -144,8 +676,44 @@ func (icon *Icon) SaveICO(ico io.Writer) error {
 //  1. First name in case-sensitive ascending order, or else...
 //  2. First ID in ascending order
 //
-func (rs *ResourceSet) SetIcon(resID Identifier, icon *Icon) error {
-	return rs.SetIconTranslation(resID, LCIDNeutral, icon)
+// As in SetIconTranslation, images that are already in the resource set are not duplicated.
+//
+func (rs *ResourceSet) SetIcon(resID Identifier, icon *Icon, opt ...resourceOption) error {
+	return rs.SetIconTranslation(resID, LCIDNeutral, icon, opt...)
+}
+
+// SetMainIcon replaces the application's icon, as shown in Windows Explorer.
+//
+// This is the first RT_GROUP_ICON resource, in the order of Walk.
+// It is replaced in every language, keeping its identifier.
+// If there is no icon yet, the icon is added as "APPICON".
+//
+// PruneReplacedImages removes the former images.
+func (rs *ResourceSet) SetMainIcon(icon *Icon, opt ...resourceOption) error {
+	var (
+		resID Identifier
+		langs []uint16
+	)
+	rs.WalkType(RT_GROUP_ICON, func(id Identifier, langID uint16, data []byte) bool {
+		if resID == nil {
+			resID = id
+		}
+		if id != resID {
+			return false
+		}
+		langs = append(langs, langID)
+		return true
+	})
+
+	if resID == nil {
+		return rs.SetIcon(Name("APPICON"), icon, opt...)
+	}
+	for _, langID := range langs {
+		if err := rs.SetIconTranslation(resID, langID, icon, opt...); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // SetIconTranslation adds the icon to a specific language in the resource set.
@@ -155,7 +723,18 @@ func (rs *ResourceSet) SetIcon(resID Identifier, icon *Icon) error {
 //  1. First name in case-sensitive ascending order, or else...
 //  2. First ID in ascending order
 //
-func (rs *ResourceSet) SetIconTranslation(resID Identifier, langID uint16, icon *Icon) error {
+// Images that are already in the resource set, for another language or another icon, are not duplicated:
+// the icon groups share the same RT_ICON IDs.
+//
+// When the icon replaces another one, PruneReplacedImages removes the former images.
+//
+func (rs *ResourceSet) SetIconTranslation(resID Identifier, langID uint16, icon *Icon, opt ...resourceOption) error {
+	options := makeResourceOptions(opt)
+	var replaced []uint16
+	if options.pruneReplaced {
+		replaced = groupImageIDs(rs.Get(RT_GROUP_ICON, resID, langID))
+	}
+
 	b := &bytes.Buffer{}
 	binary.Write(b, binary.LittleEndian, iconDirHeader{
 		Type:  1,
@@ -165,18 +744,48 @@ func (rs *ResourceSet) SetIconTranslation(resID Identifier, langID uint16, icon
 	icon.order()
 
 	for _, img := range icon.images {
-		id := rs.lastIconID + 1
+		// Images that are already in the set are shared, so translations don't duplicate them
+		id := rs.findIconImage(img.image)
+		if id == 0 {
+			id = rs.lastIconID + 1
+			if err := rs.Set(RT_ICON, ID(id), LCIDNeutral, img.image); err != nil {
+				return err
+			}
+		}
 
 		binary.Write(b, binary.LittleEndian, iconResDirEntry{
 			iconInfo: img.info,
 			Id:       id,
 		})
+	}
+	if err := rs.Set(RT_GROUP_ICON, resID, langID, b.Bytes()); err != nil {
+		return err
+	}
 
-		if err := rs.Set(RT_ICON, ID(id), LCIDNeutral, img.image); err != nil {
-			return err
+	if len(replaced) > 0 {
+		rs.pruneImages(RT_ICON, RT_GROUP_ICON, replaced)
+	}
+	return nil
+}
+
+// findIconImage returns the lowest ID of an RT_ICON resource that has the same data, or 0 if there is none.
+func (rs *ResourceSet) findIconImage(data []byte) uint16 {
+	te := rs.types[RT_ICON]
+	if te == nil {
+		return 0
+	}
+
+	var found uint16
+	for k, re := range te.resources {
+		id, ok := k.(ID)
+		if !ok || found != 0 && uint16(id) > found {
+			continue
+		}
+		if de := re.data[ID(LCIDNeutral)]; de != nil && bytes.Equal(de.data, data) {
+			found = uint16(id)
 		}
 	}
-	return rs.Set(RT_GROUP_ICON, resID, langID, b.Bytes())
+	return found
 }
 
 // GetIcon extracts an icon from a resource set.
@@ -269,7 +878,7 @@ type iconImage struct {
 // This makes a testing error reporting possible
 var pngEncode = png.Encode
 
-func (icon *Icon) addImage(img image.Image) error {
+func (icon *Icon) addImage(img image.Image, options *iconOptions) error {
 	bounds := img.Bounds()
 	if bounds.Empty() {
 		return errors.New(errInvalidImageDimensions)
@@ -280,22 +889,52 @@ func (icon *Icon) addImage(img image.Image) error {
 
 	img = imageInSquareNRGBA(img, true)
 	bounds = img.Bounds()
-	buf := &bytes.Buffer{}
-	if err := pngEncode(buf, img); err != nil {
-		return err
+
+	var (
+		data     []byte
+		bitCount = 32
+	)
+	switch options.formatFor(bounds.Size().X) {
+	case IconBMP32:
+		data = encodeDIB(toNRGBA(img), 32)
+	case IconBMP8:
+		bitCount = 8
+		data = encodeDIB(toNRGBA(img), 8)
+	case IconBMP4:
+		bitCount = 4
+		data = encodeDIB(toNRGBA(img), 4)
+	default:
+		if options.optimize {
+			var err error
+			data, err = encodeOptimizedPNG(img)
+			if err != nil {
+				return err
+			}
+			break
+		}
+		buf := &bytes.Buffer{}
+		if err := pngEncode(buf, img); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+
+	var colorCount uint8
+	if bitCount < 8 {
+		colorCount = 1 << bitCount
 	}
 
 	icon.images = append(icon.images, iconImage{
 		info: iconInfo{
 			Width:      uint8(bounds.Size().X), // 0 means 256
 			Height:     uint8(bounds.Size().Y), // 0 means 256
-			ColorCount: 0,                      // should be defined as 1 << BitCount only if BitCount < 8
+			ColorCount: colorCount,             // should be defined as 1 << BitCount only if BitCount < 8
 			Reserved:   0,
 			Planes:     1,
-			BitCount:   32,
-			BytesInRes: uint32(buf.Len()),
+			BitCount:   uint16(bitCount),
+			BytesInRes: uint32(len(data)),
 		},
-		image: buf.Bytes(),
+		image: data,
 	})
 
 	return nil
@@ -310,7 +949,7 @@ func (icon *Icon) order() {
 	})
 }
 
-func resizeImage(img image.Image, size int) image.Image {
+func resizeImage(img image.Image, size int, options *iconOptions) image.Image {
 	var (
 		sz   = img.Bounds().Size()
 		w, h = size, size
@@ -322,7 +961,95 @@ func resizeImage(img image.Image, size int) image.Image {
 		h = 0
 	}
 
-	return resize.Resize(uint(w), uint(h), img, resize.Lanczos2)
+	img = resize.Resize(uint(w), uint(h), img, options.interpolation())
+	if options.sharpening > 0 {
+		img = sharpen(toNRGBA(img), options.sharpening)
+	}
+
+	return img
+}
+
+func (options *iconOptions) interpolation() resize.InterpolationFunction {
+	switch options.resampling {
+	case ResampleLanczos3:
+		return resize.Lanczos3
+	case ResampleCatmullRom:
+		// nfnt/resize's bicubic filter is Catmull-Rom
+		return resize.Bicubic
+	case ResampleBilinear:
+		return resize.Bilinear
+	case ResampleNearestNeighbor:
+		return resize.NearestNeighbor
+	}
+	return resize.Lanczos2
+}
+
+// sharpen applies an unsharp mask to an image.
+//
+// Colors are blurred with alpha weighting, so that transparent pixels do not darken edges.
+// The alpha channel is left untouched.
+func sharpen(img *image.NRGBA, amount float64) *image.NRGBA {
+	var (
+		bounds = img.Bounds()
+		dst    = image.NewNRGBA(bounds)
+		kernel = [3]float64{1, 2, 1}
+	)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var blur [3]float64
+			var weight float64
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					p := image.Point{X: x + dx, Y: y + dy}
+					if !p.In(bounds) {
+						continue
+					}
+					c := img.NRGBAAt(p.X, p.Y)
+					w := kernel[dx+1] * kernel[dy+1] * float64(c.A)
+					blur[0] += w * float64(c.R)
+					blur[1] += w * float64(c.G)
+					blur[2] += w * float64(c.B)
+					weight += w
+				}
+			}
+
+			c := img.NRGBAAt(x, y)
+			if weight == 0 {
+				dst.SetNRGBA(x, y, c)
+				continue
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: unsharp(c.R, blur[0]/weight, amount),
+				G: unsharp(c.G, blur[1]/weight, amount),
+				B: unsharp(c.B, blur[2]/weight, amount),
+				A: c.A,
+			})
+		}
+	}
+
+	return dst
+}
+
+func unsharp(v uint8, blurred float64, amount float64) uint8 {
+	x := float64(v) + (float64(v)-blurred)*amount + 0.5
+	switch {
+	case x < 0:
+		return 0
+	case x > 0xFF:
+		return 0xFF
+	}
+	return uint8(x)
+}
+
+// toNRGBA returns img as an *image.NRGBA, converting it if necessary.
+func toNRGBA(img image.Image) *image.NRGBA {
+	if nrgba, ok := img.(*image.NRGBA); ok {
+		return nrgba
+	}
+	nrgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(nrgba, nrgba.Rect, img, img.Bounds().Min, draw.Src)
+	return nrgba
 }
 
 func imageInSquareNRGBA(img image.Image, center bool) image.Image {
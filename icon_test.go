@@ -2,8 +2,13 @@ package winres
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
 	"errors"
+	"hash/crc32"
 	"image"
+	"image/color"
+	"image/png"
 	"io"
 	"os"
 	"path/filepath"
@@ -418,6 +423,247 @@ func TestNewIconFromResizedImage_TooManySizes(t *testing.T) {
 	}
 }
 
+func TestNewIconFromSizedSources(t *testing.T) {
+	small := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range small.Pix {
+		small.Pix[i] = uint8(i)
+	}
+	master := image.NewNRGBA(image.Rect(0, 0, 512, 512))
+	for i := range master.Pix {
+		master.Pix[i] = 0xFF
+	}
+	wide := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+
+	icon, err := NewIconFromSizedSources(map[int]image.Image{16: small, 20: wide}, master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(icon.images) != 6 {
+		t.Fatal("expected 6 images, got", len(icon.images))
+	}
+
+	images, err := icon.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, img := range images {
+		sizes = append(sizes, img.Bounds().Dx())
+	}
+	if !reflect.DeepEqual(sizes, []int{256, 64, 48, 32, 20, 16}) {
+		t.Fatal("unexpected sizes", sizes)
+	}
+	checkImage(t, images[0], func(x, y int) color.NRGBA { return color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF} })
+	checkImage(t, images[5], func(x, y int) color.NRGBA { return small.NRGBAAt(x, y) })
+}
+
+func TestNewIconFromSizedSources_NoFallback(t *testing.T) {
+	icon, err := NewIconFromSizedSources(map[int]image.Image{32: image.NewNRGBA(image.Rect(0, 0, 64, 64))}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(icon.images) != 1 || icon.images[0].info.Width != 32 {
+		t.Fail()
+	}
+}
+
+func TestNewIconFromSizedSources_NonSquare(t *testing.T) {
+	checkerboard := func(w, h int) *image.NRGBA {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := uint8(0x40 + 0x80*((x+y)%2))
+				img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 0xFF})
+			}
+		}
+		return img
+	}
+	square, wide := checkerboard(16, 16), checkerboard(16, 12)
+
+	// A source that does not fit exactly is resampled, and therefore sharpened
+	icon, err := NewIconFromSizedSources(map[int]image.Image{16: wide}, nil, WithSharpening(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := icon.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].Bounds() != image.Rect(0, 0, 16, 16) {
+		t.Fatal("unexpected images")
+	}
+	same := true
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 16; x++ {
+			same = same && images[0].At(x, y+2) == color.Color(wide.NRGBAAt(x, y))
+		}
+	}
+	if same {
+		t.Error("a source that does not fit exactly should be resized")
+	}
+
+	// A source that fits exactly is kept as is
+	icon, err = NewIconFromSizedSources(map[int]image.Image{16: square}, nil, WithSharpening(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if images, err = icon.Images(); err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, images[0], func(x, y int) color.NRGBA { return square.NRGBAAt(x, y) })
+}
+
+func TestNewIconFromSizedSources_Err(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+
+	for _, sources := range []map[int]image.Image{{0: img}, {257: img}, {16: nil}} {
+		icon, err := NewIconFromSizedSources(sources, img)
+		if err == nil || icon != nil || err.Error() != errInvalidImageDimensions {
+			t.Error("expected error for", sources)
+		}
+	}
+
+	sources := make(map[int]image.Image)
+	for i := 1; i <= 31; i++ {
+		sources[i] = img
+	}
+	icon, err := NewIconFromSizedSources(sources, nil)
+	if err == nil || icon != nil || err.Error() != errTooManyIconSizes {
+		t.Fail()
+	}
+}
+
+func TestNewIconFromResizedImage_Formats(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: 0x80, A: 0xFF})
+		}
+	}
+
+	icon, err := NewIconFromResizedImage(img, []int{64, 48, 32, 16},
+		WithIconFormat(IconBMP32),
+		WithIconFormat(IconBMP8, 32),
+		WithIconFormat(IconBMP4, 16),
+		WithIconFormat(IconPNG, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []iconInfo{
+		{Width: 64, Height: 64, Planes: 1, BitCount: 32},
+		{Width: 48, Height: 48, Planes: 1, BitCount: 32},
+		{Width: 32, Height: 32, Planes: 1, BitCount: 8},
+		{Width: 16, Height: 16, ColorCount: 16, Planes: 1, BitCount: 4},
+	}
+	for i := range icon.images {
+		info := icon.images[i].info
+		if uint32(len(icon.images[i].image)) != info.BytesInRes {
+			t.Error("wrong BytesInRes")
+		}
+		info.BytesInRes = 0
+		if info != expected[i] {
+			t.Errorf("image %d: expected %v, got %v", i, expected[i], info)
+		}
+	}
+	if !bytes.HasPrefix(icon.images[0].image, []byte("\x89PNG")) || !bytes.HasPrefix(icon.images[1].image, []byte{40, 0, 0, 0}) {
+		t.Error("wrong image format")
+	}
+
+	images, err := icon.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, img := range images {
+		if img.Bounds().Dx() != int(expected[i].Width) {
+			t.Error("wrong image size")
+		}
+	}
+}
+
+func TestNewIconFromResizedImage_NearestNeighbor(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 30), G: uint8(y * 30), A: 0xFF})
+		}
+	}
+
+	icon, err := NewIconFromResizedImage(img, []int{32}, WithResampling(ResampleNearestNeighbor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := icon.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, images[0], func(x, y int) color.NRGBA { return img.NRGBAAt(x/4, y/4) })
+}
+
+func TestNewIconFromResizedImage_Resampling(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8((x + y) % 2 * 0xFF), A: 0xFF})
+		}
+	}
+
+	var results [][]byte
+	for _, r := range []resampling{ResampleLanczos2, ResampleLanczos3, ResampleCatmullRom, ResampleBilinear, ResampleNearestNeighbor} {
+		icon, err := NewIconFromResizedImage(img, []int{20}, WithResampling(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, prev := range results {
+			if bytes.Equal(prev, icon.images[0].image) {
+				t.Error("filters should give different results")
+			}
+		}
+		results = append(results, icon.images[0].image)
+	}
+
+	icon, err := NewIconFromResizedImage(img, []int{20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(results[0], icon.images[0].image) {
+		t.Error("Lanczos2 should be the default filter")
+	}
+}
+
+func TestNewIconFromResizedImage_Sharpening(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(0x40)
+			if x >= 32 {
+				v = 0xC0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 0xFF})
+		}
+	}
+
+	var edges [2][2]uint8
+	for i, amount := range []float64{0, 1} {
+		icon, err := NewIconFromResizedImage(img, []int{16}, WithResampling(ResampleBilinear), WithSharpening(amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+		images, err := icon.Images()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := toNRGBA(images[0])
+		edges[i] = [2]uint8{m.NRGBAAt(7, 8).R, m.NRGBAAt(8, 8).R}
+		if m.NRGBAAt(0, 0).R != 0x40 || m.NRGBAAt(15, 15).R != 0xC0 {
+			t.Error("flat areas should not change")
+		}
+	}
+	if edges[1][0] >= edges[0][0] || edges[1][1] <= edges[0][1] {
+		t.Error("the edge should be sharper", edges)
+	}
+}
+
 func TestResourceSet_SetIcon(t *testing.T) {
 	rs := ResourceSet{}
 
@@ -473,6 +719,125 @@ func TestResourceSet_SetIconTranslation(t *testing.T) {
 	checkIconResource(t, &rs, Name("ANOTHERICO"), 0x409, icon3)
 }
 
+func TestResourceSet_SetIconTranslation_Shared(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	icon1, err := NewIconFromResizedImage(img, []int{64, 32, 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same small images, different large image
+	icon2, err := NewIconFromResizedImage(img, []int{32, 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img = image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 0xFF, A: 0xFF})
+	icon2.AddImage(img)
+
+	rs := ResourceSet{}
+	rs.SetIconTranslation(Name("APPICON"), 0x409, icon1)
+	rs.SetIconTranslation(Name("APPICON"), 0x40C, icon1)
+	rs.SetIconTranslation(Name("APPICON"), 0x407, icon2)
+	rs.SetIcon(ID(2), icon1)
+
+	// icon2 only adds its own 64x64 image
+	if rs.lastIconID != 4 || rs.types[RT_ICON] == nil || len(rs.types[RT_ICON].resources) != 4 {
+		t.Fatal("images should be shared", rs.lastIconID)
+	}
+	ids := func(langID uint16, resID Identifier) []uint16 {
+		data := rs.Get(RT_GROUP_ICON, resID, langID)
+		var ids []uint16
+		for i := 0; i < int(data[4]); i++ {
+			ids = append(ids, binary.LittleEndian.Uint16(data[6+i*14+12:]))
+		}
+		return ids
+	}
+	for _, tt := range []struct {
+		resID  Identifier
+		langID uint16
+		ids    []uint16
+	}{
+		{Name("APPICON"), 0x409, []uint16{1, 2, 3}},
+		{Name("APPICON"), 0x40C, []uint16{1, 2, 3}},
+		{Name("APPICON"), 0x407, []uint16{4, 2, 3}},
+		{ID(2), 0, []uint16{1, 2, 3}},
+	} {
+		if got := ids(tt.langID, tt.resID); !reflect.DeepEqual(got, tt.ids) {
+			t.Errorf("%v 0x%X: expected IDs %v, got %v", tt.resID, tt.langID, tt.ids, got)
+		}
+	}
+
+	icon, err := rs.GetIconTranslation(Name("APPICON"), 0x407)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(icon.images, icon2.images) {
+		t.Error("icon differs")
+	}
+}
+
+func TestResourceSet_SetMainIcon(t *testing.T) {
+	newIcon := func(c uint8) *Icon {
+		img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+		img.Pix[3] = c
+		icon, err := NewIconFromImages([]image.Image{img})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return icon
+	}
+	var (
+		old     = newIcon(1)
+		other   = newIcon(2)
+		newMain = newIcon(3)
+	)
+
+	rs := ResourceSet{}
+	rs.SetIcon(ID(1), other)
+	rs.SetIconTranslation(Name("a"), 0x409, other)
+	rs.SetIconTranslation(Name("B"), 0x409, old)
+	rs.SetIconTranslation(Name("B"), 0x40C, old)
+
+	if err := rs.SetMainIcon(newMain, PruneReplacedImages()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		resID  Identifier
+		langID uint16
+		icon   *Icon
+	}{
+		{Name("B"), 0x409, newMain},
+		{Name("B"), 0x40C, newMain},
+		{Name("a"), 0x409, other},
+		{ID(1), 0, other},
+	} {
+		icon, err := rs.GetIconTranslation(tt.resID, tt.langID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(icon.images, tt.icon.images) {
+			t.Errorf("%v 0x%X: wrong icon", tt.resID, tt.langID)
+		}
+	}
+	if len(rs.types[RT_ICON].resources) != 2 || len(rs.types[RT_GROUP_ICON].resources) != 3 {
+		t.Error("unexpected resources")
+	}
+
+	rs = ResourceSet{}
+	if err := rs.SetMainIcon(newMain); err != nil {
+		t.Fatal(err)
+	}
+	if icon, err := rs.GetIcon(Name("APPICON")); err != nil || !reflect.DeepEqual(icon.images, newMain.images) {
+		t.Error("the icon should be added as APPICON", err)
+	}
+
+	rs.lastIconID = 0xFFFF
+	if err := rs.SetMainIcon(newIcon(4)); err == nil || err.Error() != errZeroID {
+		t.Error("expected error", errZeroID)
+	}
+}
+
 func TestResourceSet_GetIconTranslation_Err(t *testing.T) {
 	rs := ResourceSet{}
 
@@ -556,3 +921,427 @@ func icoToBinary(icon *Icon) []byte {
 	icon.SaveICO(buf)
 	return buf.Bytes()
 }
+
+func TestIcon_Images(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 24, 16))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+
+	icon, err := NewIconFromImages([]image.Image{src})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := ResourceSet{}
+	rs.SetIcon(ID(1), icon)
+	icon, err = rs.GetIcon(ID(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := icon.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].Bounds() != image.Rect(0, 0, 24, 24) {
+		t.Fatal("unexpected images")
+	}
+	checkImage(t, images[0], func(x, y int) color.NRGBA {
+		if y < 4 || y >= 20 {
+			return color.NRGBA{}
+		}
+		return src.NRGBAAt(x, y-4)
+	})
+}
+
+func TestIcon_Images_Err(t *testing.T) {
+	icon := &Icon{images: []iconImage{{image: []byte{12, 0, 0, 0}}}}
+	images, err := icon.Images()
+	if err == nil || images != nil {
+		t.Fail()
+	}
+}
+
+func TestIcon_Validate(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	newIcon := func() *Icon {
+		icon, err := NewIconFromResizedImage(img, []int{256, 32, 16}, WithIconFormat(IconBMP8, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return icon
+	}
+	if err := newIcon().Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	big := &bytes.Buffer{}
+	png.Encode(big, image.NewNRGBA(image.Rect(0, 0, 300, 300)))
+
+	for _, tt := range []struct {
+		name   string
+		modify func(icon *Icon)
+		err    string
+	}{
+		{"width", func(icon *Icon) { icon.images[1].info.Width = 24 }, "image 1: " + errDimensionsMismatch},
+		{"height 256", func(icon *Icon) { icon.images[0].info.Height = 255 }, "image 0: " + errDimensionsMismatch},
+		{"bit count", func(icon *Icon) { icon.images[2].info.BitCount = 4 }, "image 2: " + errBitCountMismatch},
+		{"length", func(icon *Icon) { icon.images[2].info.BytesInRes++ }, "image 2: " + errLengthMismatch},
+		{"duplicate", func(icon *Icon) { icon.images = append(icon.images, icon.images[1]) }, "image 3: " + errDuplicateImage},
+		{"png too big", func(icon *Icon) {
+			icon.images[0].image = big.Bytes()
+			icon.images[0].info.BytesInRes = uint32(big.Len())
+		}, "image 0: " + errImageTooBig},
+		{"unknown format", func(icon *Icon) { icon.images[1].image[0] = 12 }, "image 1: " + errUnknownImageFormat},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			icon := newIcon()
+			tt.modify(icon)
+			err := icon.Validate()
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	// Bit count is often unspecified in ICO files
+	icon := newIcon()
+	icon.images[2].info.BitCount = 0
+	if err := icon.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadICOStrict(t *testing.T) {
+	icon, err := NewIconFromResizedImage(image.NewNRGBA(image.Rect(0, 0, 32, 32)), []int{32, 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	icon.SaveICO(buf)
+	ico := buf.Bytes()
+
+	if _, err = LoadICOStrict(bytes.NewReader(ico)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second entry's width
+	ico[6+16] = 24
+	if _, err = LoadICO(bytes.NewReader(ico)); err != nil {
+		t.Fatal(err)
+	}
+	icon, err = LoadICOStrict(bytes.NewReader(ico))
+	if icon != nil || err == nil || err.Error() != "image 1: "+errDimensionsMismatch {
+		t.Fail()
+	}
+
+	icon, err = LoadICOStrict(bytes.NewReader(ico[:4]))
+	if icon != nil || err != io.ErrUnexpectedEOF {
+		t.Fail()
+	}
+}
+
+func TestIcon_Entries(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	icon, err := NewIconFromResizedImage(img, []int{16, 256, 32}, WithIconFormat(IconBMP4, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := icon.Entries()
+	expected := []IconEntry{
+		{Width: 256, Height: 256, BitCount: 32, PNG: true, Size: len(icon.images[0].image)},
+		{Width: 32, Height: 32, BitCount: 32, PNG: true, Size: len(icon.images[1].image)},
+		{Width: 16, Height: 16, BitCount: 4, Size: 40 + 64 + 8*16 + 4*16},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("expected %v, got %v", expected, entries)
+	}
+}
+
+func TestIcon_EditEntries(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 256, 256))
+	icon, err := NewIconFromResizedImage(img, []int{256, 48, 32, 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img32 := icon.images[2].image
+
+	// Strip the 256px image
+	if err = icon.RemoveEntry(0); err != nil {
+		t.Fatal(err)
+	}
+	// Add a missing 24px image
+	if err = icon.AddImage(image.NewNRGBA(image.Rect(0, 0, 24, 24)), WithIconFormat(IconBMP32)); err != nil {
+		t.Fatal(err)
+	}
+	// Replace the 48px image with a low color one
+	if err = icon.ReplaceEntry(0, image.NewNRGBA(image.Rect(0, 0, 48, 48)), WithIconFormat(IconBMP8)); err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes [][2]int
+	for _, e := range icon.Entries() {
+		sizes = append(sizes, [2]int{e.Width, e.BitCount})
+	}
+	if !reflect.DeepEqual(sizes, [][2]int{{32, 32}, {24, 32}, {16, 32}, {48, 8}}) {
+		t.Fatal("unexpected entries", sizes)
+	}
+	if !bytes.Equal(icon.images[0].image, img32) {
+		t.Error("other images should not be modified")
+	}
+	if err = icon.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIcon_EditEntries_Err(t *testing.T) {
+	icon, err := NewIconFromResizedImage(image.NewNRGBA(image.Rect(0, 0, 16, 16)), []int{16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []int{-1, 1} {
+		if err = icon.RemoveEntry(i); err == nil || err.Error() != errEntryIndexOutOfRange {
+			t.Error("expected error for RemoveEntry", i)
+		}
+		if err = icon.ReplaceEntry(i, image.NewNRGBA(image.Rect(0, 0, 16, 16))); err == nil || err.Error() != errEntryIndexOutOfRange {
+			t.Error("expected error for ReplaceEntry", i)
+		}
+	}
+	if err = icon.ReplaceEntry(0, image.NewNRGBA(image.Rect(0, 0, 257, 16))); err == nil || err.Error() != errImageTooBig {
+		t.Error("expected error for ReplaceEntry")
+	}
+	if err = icon.AddImage(image.NewNRGBA(image.Rect(0, 0, 0, 16))); err == nil || err.Error() != errInvalidImageDimensions {
+		t.Error("expected error for AddImage")
+	}
+	if len(icon.images) != 1 {
+		t.Error("icon should not be modified")
+	}
+}
+
+func TestIcon_Merge(t *testing.T) {
+	icon1, err := NewIconFromResizedImage(image.NewNRGBA(image.Rect(0, 0, 64, 64)), []int{64, 32, 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	icon2, err := NewIconFromResizedImage(image.NewNRGBA(image.Rect(0, 0, 64, 64)), []int{48, 32}, WithIconFormat(IconBMP8, 48))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	icon1.Merge(icon2)
+
+	var sizes [][2]int
+	for _, e := range icon1.Entries() {
+		sizes = append(sizes, [2]int{e.Width, e.BitCount})
+	}
+	if !reflect.DeepEqual(sizes, [][2]int{{64, 32}, {32, 32}, {16, 32}, {48, 8}}) {
+		t.Fatal("unexpected entries", sizes)
+	}
+	if &icon1.images[1].image[0] != &icon2.images[1].image[0] {
+		t.Error("the 32px image should have been replaced")
+	}
+}
+
+func TestNewIconFromImages_PNGOptimization(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 128, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 128; x++ {
+			if (x/8+y/8)%3 != 0 {
+				img.SetNRGBA(x, y, color.NRGBA{R: uint8(x / 8 * 16), G: uint8(y / 8 * 16), B: 0x80, A: 0xC0})
+			}
+		}
+	}
+
+	icon1, err := NewIconFromImages([]image.Image{img})
+	if err != nil {
+		t.Fatal(err)
+	}
+	icon2, err := NewIconFromImages([]image.Image{img}, WithPNGOptimization())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(icon2.images[0].image) >= len(icon1.images[0].image) {
+		t.Error("optimized image should be smaller")
+	}
+	if err = icon2.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	images, err := icon2.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, images[0], func(x, y int) color.NRGBA { return img.NRGBAAt(x, y) })
+}
+
+func TestIcon_OptimizePNG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8(x ^ y), A: 0xFF})
+		}
+	}
+	icon, err := NewIconFromResizedImage(img, []int{64, 32, 16}, WithIconFormat(IconBMP8, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := icon.Entries()
+	dib := icon.images[2].image
+
+	if err = icon.OptimizePNG(); err != nil {
+		t.Fatal(err)
+	}
+
+	after := icon.Entries()
+	if after[0].Size >= before[0].Size || after[1].Size > before[1].Size {
+		t.Error("PNG images should be smaller", before, after)
+	}
+	if &icon.images[2].image[0] != &dib[0] {
+		t.Error("DIB images should not be modified")
+	}
+	if err = icon.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	images, err := icon.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkImage(t, images[0], func(x, y int) color.NRGBA { return img.NRGBAAt(x, y) })
+}
+
+func TestIcon_OptimizePNG_Ancillary(t *testing.T) {
+	chunk := func(typ string, data []byte) []byte {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+		b = append(append(b, typ...), data...)
+		return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+	}
+
+	// A 1 bit grayscale image, which cannot be made smaller by the encoder
+	raw := make([]byte, 16*3)
+	for y := 0; y < 16; y++ {
+		raw[y*3+1] = 0xF0
+	}
+	idat := &bytes.Buffer{}
+	zw, _ := zlib.NewWriterLevel(idat, zlib.BestCompression)
+	zw.Write(raw)
+	zw.Close()
+	stripped := append([]byte{}, pngSignature...)
+	stripped = append(stripped, chunk("IHDR", []byte{0, 0, 0, 16, 0, 0, 0, 16, 1, 0, 0, 0, 0})...)
+	stripped = append(stripped, chunk("IDAT", idat.Bytes())...)
+	data := append(append([]byte{}, stripped...), chunk("tEXt", []byte("Comment\x00Hello"))...)
+	data = append(data, chunk("IEND", nil)...)
+	stripped = append(stripped, chunk("IEND", nil)...)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if optimized, _ := encodeOptimizedPNG(img); len(optimized) <= len(stripped) {
+		t.Fatal("the image should not be optimizable")
+	}
+
+	icon := &Icon{images: []iconImage{{info: iconInfo{Width: 16, Height: 16, Planes: 1, BitCount: 32, BytesInRes: uint32(len(data))}, image: data}}}
+	if err = icon.OptimizePNG(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(icon.images[0].image, stripped) || icon.images[0].info.BytesInRes != uint32(len(stripped)) {
+		t.Error("ancillary chunks should be removed")
+	}
+}
+
+func TestIcon_OptimizePNG_Err(t *testing.T) {
+	icon := &Icon{images: []iconImage{{image: append(append([]byte{}, pngSignature...), 0, 0)}}}
+	if err := icon.OptimizePNG(); err == nil {
+		t.Fail()
+	}
+}
+
+func TestIcon_SavePNGs(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+	icon, err := NewIconFromResizedImage(img, []int{64, 32, 16}, WithIconFormat(IconBMP32, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	icon.AddImage(image.NewNRGBA(image.Rect(0, 0, 32, 32)), WithIconFormat(IconBMP8))
+
+	dir := t.TempDir()
+	if err = icon.SavePNGs(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 3 {
+		t.Fatal("expected 3 files, got", files)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "64x64.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, icon.images[0].image) {
+		t.Error("PNG images should be saved as is")
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "16x16.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, _ := icon.Images()
+	for _, img := range images {
+		if img.Bounds().Dx() == 16 {
+			checkImage(t, saved, func(x, y int) color.NRGBA { return toNRGBA(img).NRGBAAt(x, y) })
+		}
+	}
+
+	if err = icon.SavePNGs(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestIcon_SaveICNS(t *testing.T) {
+	icon, err := NewIconFromResizedImage(image.NewNRGBA(image.Rect(0, 0, 256, 256)), []int{256, 48, 32, 16}, WithIconFormat(IconBMP4, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = icon.SaveICNS(buf); err != nil {
+		t.Fatal(err)
+	}
+	icns := buf.Bytes()
+
+	if string(icns[:4]) != "icns" || binary.BigEndian.Uint32(icns[4:]) != uint32(len(icns)) {
+		t.Fatal("invalid ICNS header")
+	}
+	var types []string
+	for pos := 8; pos < len(icns); {
+		length := int(binary.BigEndian.Uint32(icns[pos+4:]))
+		if !bytes.HasPrefix(icns[pos+8:], pngSignature) {
+			t.Error("elements should be PNG")
+		}
+		types = append(types, string(icns[pos:pos+4]))
+		pos += length
+	}
+	if !reflect.DeepEqual(types, []string{"ic08", "ic13", "icp5", "ic11", "icp4"}) {
+		t.Error("unexpected types", types)
+	}
+
+	icon, _ = NewIconFromResizedImage(image.NewNRGBA(image.Rect(0, 0, 48, 48)), []int{48})
+	if err = icon.SaveICNS(buf); err == nil || err.Error() != errNoICNSSize {
+		t.Error("expected error", errNoICNSSize)
+	}
+	icon, _ = NewIconFromResizedImage(image.NewNRGBA(image.Rect(0, 0, 16, 16)), []int{16})
+	if err = icon.SaveICNS(newBadWriter(5)); !isExpectedWriteErr(err) {
+		t.Error("expected write error")
+	}
+	if err = icon.SaveICNS(newBadWriter(10)); !isExpectedWriteErr(err) {
+		t.Error("expected write error")
+	}
+}
@@ -18,10 +18,13 @@ type AppManifest struct {
 	Identity                          AssemblyIdentity `json:"identity"`
 	Description                       string           `json:"description"`
 	Compatibility                     SupportedOS      `json:"minimum-os"`
+	SupportedOSList                   []string         `json:"supported-os,omitempty"`       // GUIDs of the supported OS, such as OSWin10, overriding Compatibility (other values are dropped)
+	MaxVersionTested                  string           `json:"max-version-tested,omitempty"` // Highest Windows version the application was tested on, such as "10.0.22621.0"
 	ExecutionLevel                    ExecutionLevel   `json:"execution-level"`
 	UIAccess                          bool             `json:"ui-access"` // Require access to other applications' UI elements
 	AutoElevate                       bool             `json:"auto-elevate"`
 	DPIAwareness                      DPIAwareness     `json:"dpi-awareness"`
+	DPIAwarenessFallback              []DPIAwareness   `json:"dpi-awareness-fallback,omitempty"` // Values to try in order when DPIAwareness is not supported (DPIPerMonitorV2 falls back to DPIAware by default)
 	DisableTheming                    bool             `json:"disable-theming"`
 	DisableWindowFiltering            bool             `json:"disable-window-filtering"`
 	HighResolutionScrollingAware      bool             `json:"high-resolution-scrolling-aware"`
@@ -30,22 +33,88 @@ type AppManifest struct {
 	PrinterDriverIsolation            bool             `json:"printer-driver-isolation"`
 	GDIScaling                        bool             `json:"gdi-scaling"`
 	SegmentHeap                       bool             `json:"segment-heap"`
-	UseCommonControlsV6               bool             `json:"use-common-controls-v6"` // Application requires Common Controls V6 (V5 remains the default)
+	ActiveCodePage                    ActiveCodePage   `json:"active-code-page,omitempty"`
+	SupportedArchitectures            []string         `json:"supported-architectures,omitempty"` // Architectures the application natively supports, such as "amd64" and "arm64"
+	UseCommonControlsV6               bool             `json:"use-common-controls-v6"`            // Application requires Common Controls V6 (V5 remains the default)
+	// Dependencies lists side-by-side assemblies required by the application, such as private assemblies or the VC runtime.
+	// Common Controls V6 should rather be required by UseCommonControlsV6.
+	Dependencies []AssemblyIdentity `json:"dependencies,omitempty"`
+	// Files declares the files of the assembly, such as COM servers for registration-free activation
+	Files []ManifestFile `json:"files,omitempty"`
+	// ExternalProxyStubs declares interfaces whose proxy/stub is implemented outside of the assembly, such as automation interfaces
+	ExternalProxyStubs []COMInterface `json:"external-proxy-stubs,omitempty"`
 }
 
-// AssemblyIdentity defines the side-by-side assembly identity of the executable.
+// ManifestFile describes a <file> element, which declares a file of the assembly and the COM objects
+// and window classes it provides.
+type ManifestFile struct {
+	Name          string        `json:"name"`
+	COMClasses    []COMClass    `json:"com-classes,omitempty"`
+	TypeLibs      []TypeLib     `json:"typelibs,omitempty"`
+	WindowClasses []WindowClass `json:"window-classes,omitempty"`
+}
+
+// COMClass describes a <comClass> element, which declares a COM class implemented by a file.
+//
+// Only CLSID is required. Identifiers such as CLSID and TLBID are GUIDs written between braces.
+type COMClass struct {
+	CLSID          string `json:"clsid"`
+	ThreadingModel string `json:"threading-model,omitempty"` // "Apartment", "Free", "Both" or "Neutral"
+	ProgID         string `json:"progid,omitempty"`
+	TLBID          string `json:"tlbid,omitempty"`
+	Description    string `json:"description,omitempty"`
+}
+
+// TypeLib describes a <typelib> element, which declares a type library.
+type TypeLib struct {
+	TLBID      string `json:"tlbid"`
+	Version    string `json:"version"`
+	HelpDir    string `json:"help-dir"`
+	ResourceID string `json:"resource-id,omitempty"`
+	Flags      string `json:"flags,omitempty"`
+}
+
+// COMInterface describes a <comInterfaceExternalProxyStub> element.
+//
+// Only IID is required.
+type COMInterface struct {
+	IID              string `json:"iid"`
+	Name             string `json:"name,omitempty"`
+	TLBID            string `json:"tlbid,omitempty"`
+	ProxyStubCLSID32 string `json:"proxy-stub-clsid32,omitempty"`
+	NumMethods       int    `json:"num-methods,omitempty"`
+	BaseInterface    string `json:"base-interface,omitempty"`
+}
+
+// WindowClass describes a <windowClass> element, which declares a window class registered by a file.
 //
-// It should not be needed unless another assembly depends on this one.
+// Window classes are versioned by default, which means their name is prefixed by the assembly's identity.
+type WindowClass struct {
+	Name        string `json:"name"`
+	Unversioned bool   `json:"unversioned,omitempty"`
+}
+
+// AssemblyIdentity defines the side-by-side assembly identity of the executable, or of one of its dependencies.
 //
-// If the Name field is empty, the <assemblyIdentity> element will be omitted.
+// The executable's identity should not be needed unless another assembly depends on this one.
+// If its Name field is empty, the <assemblyIdentity> element will be omitted.
+//
+// Type defaults to "win32" and ProcessorArchitecture defaults to "*".
+// AppManifestFromXML only reads the Name and Version of the executable's identity,
+// but it reads every field of dependencies.
 type AssemblyIdentity struct {
-	Name    string
-	Version [4]uint16
+	Name                  string
+	Version               [4]uint16
+	Type                  string
+	ProcessorArchitecture string
+	PublicKeyToken        string
+	Language              string
 }
 
 // DPIAwareness is an enumeration which corresponds to the <dpiAware> and the <dpiAwareness> elements.
 //
-// When it is set to DPIPerMonitorV2, it will fallback to DPIAware if the OS does not support it.
+// When it is set to DPIPerMonitorV2, it will fallback to DPIAware if the OS does not support it,
+// unless AppManifest.DPIAwarenessFallback says otherwise.
 //
 // DPIPerMonitor would not scale windows on secondary monitors.
 type DPIAwareness int
@@ -57,11 +126,28 @@ const (
 	DPIPerMonitorV2
 )
 
+// ActiveCodePage corresponds to the <activeCodePage> element, which sets the process code page.
+//
+// Its zero value omits the element, so the system's code page is used.
+// Windows 11 also accepts a locale name such as "en-US", to use the code page of that locale.
+type ActiveCodePage string
+
+const (
+	CodePageDefault ActiveCodePage = ""
+	// CodePageUTF8 makes UTF-8 the process code page, so that "A" APIs and the C runtime accept UTF-8 strings.
+	// It requires Windows 10 version 1903.
+	CodePageUTF8   ActiveCodePage = "UTF-8"
+	CodePageLegacy ActiveCodePage = "Legacy"
+)
+
 // SupportedOS is an enumeration that provides a simplified way to fill the
 // compatibility element in an application manifest, by only setting a minimum OS.
 //
 // Its zero value is Win7AndAbove, which matches Go's requirements.
 //
+// Windows 11 has no GUID of its own, it is covered by Win10AndAbove.
+// AppManifest.SupportedOSList can be used for an explicit list of GUIDs.
+//
 // https://github.com/golang/go/wiki/MinimumRequirements#windows
 type SupportedOS int
 
@@ -82,20 +168,23 @@ const (
 	RequireAdministrator
 )
 
+// GUIDs of the <supportedOS> elements, to be used in AppManifest.SupportedOSList.
+//
+// OSWin10 also stands for Windows 11 and Windows Server 2016 and above.
 const (
-	osWin10    = "{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"
-	osWin81    = "{1f676c76-80e1-4239-95bb-83d0f6d0da78}"
-	osWin8     = "{4a2f28e3-53b9-4441-ba9c-d69d4a4a6e38}"
-	osWin7     = "{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"
-	osWinVista = "{e2011457-1546-43c5-a5fe-008deee3d3f0}"
+	OSWin10    = "{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"
+	OSWin81    = "{1f676c76-80e1-4239-95bb-83d0f6d0da78}"
+	OSWin8     = "{4a2f28e3-53b9-4441-ba9c-d69d4a4a6e38}"
+	OSWin7     = "{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"
+	OSWinVista = "{e2011457-1546-43c5-a5fe-008deee3d3f0}"
 )
 
 // language=GoTemplate
 var manifestTemplate = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
 <assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
-{{- if .AssemblyName}}
+{{- with .AssemblyIdentity}}
 
-  <assemblyIdentity type="win32" name="{{.AssemblyName | html}}" version="{{.AssemblyVersion}}" processorArchitecture="*"/>
+  <assemblyIdentity {{template "identity" .}}/>
 {{- end}}
 {{- if .Description}}
   <description>{{.Description | html}}</description>
@@ -103,8 +192,11 @@ var manifestTemplate = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
 
   <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
     <application>
+      {{- with .MaxVersionTested}}
+      <maxversiontested Id="{{. | html}}"/>
+      {{- end}}
       {{- range $osID := .SupportedOS}}
-      <supportedOS Id="{{$osID}}"/>
+      <supportedOS Id="{{$osID | html}}"/>
       {{- end}}
     </application>
   </compatibility>
@@ -140,6 +232,12 @@ var manifestTemplate = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
       {{- if .SegmentHeap}}
       <heapType xmlns="http://schemas.microsoft.com/SMI/2020/WindowsSettings">SegmentHeap</heapType>
       {{- end}}
+      {{- with .ActiveCodePage}}
+      <activeCodePage xmlns="http://schemas.microsoft.com/SMI/2019/WindowsSettings">{{. | html}}</activeCodePage>
+      {{- end}}
+      {{- with .Architectures}}
+      <supportedArchitectures xmlns="http://schemas.microsoft.com/SMI/2024/WindowsSettings">{{. | html}}</supportedArchitectures>
+      {{- end}}
     </windowsSettings>
   </application>
 
@@ -158,79 +256,200 @@ var manifestTemplate = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
     </dependentAssembly>
   </dependency>
   {{- end}}
+  {{- range .DependentAssemblies}}
+
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity {{template "identity" .}}/>
+    </dependentAssembly>
+  </dependency>
+  {{- end}}
+  {{- range .Files}}
+
+  <file name="{{.Name | html}}">
+    {{- range .COMClasses}}
+    <comClass clsid="{{.CLSID | html}}"
+      {{- with .ThreadingModel}} threadingModel="{{. | html}}"{{end}}
+      {{- with .ProgID}} progid="{{. | html}}"{{end}}
+      {{- with .TLBID}} tlbid="{{. | html}}"{{end}}
+      {{- with .Description}} description="{{. | html}}"{{end}}/>
+    {{- end}}
+    {{- range .TypeLibs}}
+    <typelib tlbid="{{.TLBID | html}}" version="{{.Version | html}}" helpdir="{{.HelpDir | html}}"
+      {{- with .ResourceID}} resourceid="{{. | html}}"{{end}}
+      {{- with .Flags}} flags="{{. | html}}"{{end}}/>
+    {{- end}}
+    {{- range .WindowClasses}}
+    <windowClass{{if .Unversioned}} versioned="no"{{end}}>{{.Name | html}}</windowClass>
+    {{- end}}
+  </file>
+  {{- end}}
+  {{- if .ExternalProxyStubs}}
+{{range .ExternalProxyStubs}}
+  <comInterfaceExternalProxyStub iid="{{.IID | html}}"
+    {{- with .Name}} name="{{. | html}}"{{end}}
+    {{- with .TLBID}} tlbid="{{. | html}}"{{end}}
+    {{- with .ProxyStubCLSID32}} proxyStubClsid32="{{. | html}}"{{end}}
+    {{- with .NumMethods}} numMethods="{{.}}"{{end}}
+    {{- with .BaseInterface}} baseInterface="{{. | html}}"{{end}}/>
+  {{- end}}
+  {{- end}}
 
 </assembly>
+{{- define "identity"}}type="{{.Type | html}}" name="{{.Name | html}}" version="{{.Version}}" processorArchitecture="{{.ProcessorArchitecture | html}}"
+  {{- with .PublicKeyToken}} publicKeyToken="{{. | html}}"{{end}}
+  {{- with .Language}} language="{{. | html}}"{{end}}
+{{- end}}
 `
 
 func makeManifest(manifest AppManifest) []byte {
 	vars := struct {
 		AppManifest
-		AssemblyName    string
-		AssemblyVersion string
-		SupportedOS     []string
-		DPIAware        string
-		DPIAwareness    string
-		ExecutionLevel  string
+		AssemblyIdentity    *assemblyIdentityAttrs
+		DependentAssemblies []assemblyIdentityAttrs
+		SupportedOS         []string
+		DPIAware            string
+		DPIAwareness        string
+		ExecutionLevel      string
+		Architectures       string
 	}{AppManifest: manifest}
 
 	if manifest.Identity.Name != "" {
-		vars.AssemblyName = manifest.Identity.Name
-		v := manifest.Identity.Version
-		vars.AssemblyVersion = fmt.Sprintf("%d.%d.%d.%d", v[0], v[1], v[2], v[3])
+		attrs := makeAssemblyIdentityAttrs(manifest.Identity)
+		vars.AssemblyIdentity = &attrs
 	}
+	for _, dep := range manifest.Dependencies {
+		vars.DependentAssemblies = append(vars.DependentAssemblies, makeAssemblyIdentityAttrs(dep))
+	}
+
+	vars.SupportedOS = supportedOSList(manifest.Compatibility, manifest.SupportedOSList)
+	vars.ExecutionLevel = executionLevelString(manifest.ExecutionLevel)
+	vars.DPIAware, vars.DPIAwareness = dpiAwarenessStrings(manifest.DPIAwareness, manifest.DPIAwarenessFallback)
+	vars.Architectures = strings.Join(manifest.SupportedArchitectures, " ")
 
-	vars.SupportedOS = []string{
-		osWin10,
-		osWin81,
-		osWin8,
-		osWin7,
-		osWinVista,
+	buf := &bytes.Buffer{}
+	tmpl := template.Must(template.New("manifest").Parse(manifestTemplate))
+	err := tmpl.Execute(buf, vars)
+	if err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+// assemblyIdentityAttrs holds the attributes of an <assemblyIdentity> element.
+type assemblyIdentityAttrs struct {
+	Type                  string
+	Name                  string
+	Version               string
+	ProcessorArchitecture string
+	PublicKeyToken        string
+	Language              string
+}
+
+func makeAssemblyIdentityAttrs(ai AssemblyIdentity) assemblyIdentityAttrs {
+	attrs := assemblyIdentityAttrs{
+		Type:                  ai.Type,
+		Name:                  ai.Name,
+		Version:               fmt.Sprintf("%d.%d.%d.%d", ai.Version[0], ai.Version[1], ai.Version[2], ai.Version[3]),
+		ProcessorArchitecture: ai.ProcessorArchitecture,
+		PublicKeyToken:        ai.PublicKeyToken,
+		Language:              ai.Language,
+	}
+	if attrs.Type == "" {
+		attrs.Type = "win32"
+	}
+	if attrs.ProcessorArchitecture == "" {
+		attrs.ProcessorArchitecture = "*"
+	}
+	return attrs
+}
+
+// supportedOSList returns the GUIDs of explicitList if there are any,
+// or else the GUIDs of the supported OS, from the most recent to the minimum OS.
+//
+// Entries of explicitList that are not GUIDs are dropped.
+func supportedOSList(minOS SupportedOS, explicitList []string) []string {
+	var guids []string
+	for _, id := range explicitList {
+		if isGUID(id) {
+			guids = append(guids, id)
+		}
+	}
+	if len(guids) > 0 {
+		return guids
 	}
-	switch manifest.Compatibility {
+	list := []string{
+		OSWin10,
+		OSWin81,
+		OSWin8,
+		OSWin7,
+		OSWinVista,
+	}
+	switch minOS {
 	case Win7AndAbove:
-		vars.SupportedOS = vars.SupportedOS[:4]
+		list = list[:4]
 	case Win8AndAbove:
-		vars.SupportedOS = vars.SupportedOS[:3]
+		list = list[:3]
 	case Win81AndAbove:
-		vars.SupportedOS = vars.SupportedOS[:2]
+		list = list[:2]
 	case Win10AndAbove:
-		vars.SupportedOS = vars.SupportedOS[:1]
+		list = list[:1]
 	}
+	return list
+}
 
-	switch manifest.ExecutionLevel {
+func executionLevelString(level ExecutionLevel) string {
+	switch level {
 	case RequireAdministrator:
-		vars.ExecutionLevel = "requireAdministrator"
+		return "requireAdministrator"
 	case HighestAvailable:
-		vars.ExecutionLevel = "highestAvailable"
-	default:
-		vars.ExecutionLevel = "asInvoker"
+		return "highestAvailable"
 	}
+	return "asInvoker"
+}
 
-	switch manifest.DPIAwareness {
-	case DPIAware:
-		vars.DPIAware = "true"
-		vars.DPIAwareness = "system"
+// dpiAwarenessStrings returns the values of the <dpiAware> and <dpiAwareness> elements.
+func dpiAwarenessStrings(a DPIAwareness, fallback []DPIAwareness) (string, string) {
+	var dpiAware string
+	switch a {
+	case DPIAware, DPIPerMonitorV2:
+		dpiAware = "true"
 	case DPIPerMonitor:
-		vars.DPIAware = "true/pm"
-		vars.DPIAwareness = "permonitor"
-	case DPIPerMonitorV2:
+		dpiAware = "true/pm"
+	case DPIUnaware:
+		dpiAware = "false"
+	default:
+		return "", ""
+	}
+	if len(fallback) == 0 && a == DPIPerMonitorV2 {
 		// PerMonitorV2 fixes the scale on secondary monitors
 		// If not available, the closest option seems to be System
-		vars.DPIAware = "true"
-		vars.DPIAwareness = "permonitorv2,system"
-	case DPIUnaware:
-		vars.DPIAware = "false"
-		vars.DPIAwareness = "unaware"
+		fallback = []DPIAwareness{DPIAware}
 	}
 
-	buf := &bytes.Buffer{}
-	tmpl := template.Must(template.New("manifest").Parse(manifestTemplate))
-	err := tmpl.Execute(buf, vars)
-	if err != nil {
-		panic(err)
+	list := []string{dpiAwarenessValue(a)}
+	for _, f := range fallback {
+		if v := dpiAwarenessValue(f); v != "" {
+			list = append(list, v)
+		}
 	}
+	return dpiAware, strings.Join(list, ",")
+}
 
-	return buf.Bytes()
+// dpiAwarenessValue returns the value of a in a <dpiAwareness> element.
+func dpiAwarenessValue(a DPIAwareness) string {
+	switch a {
+	case DPIAware:
+		return "system"
+	case DPIPerMonitor:
+		return "permonitor"
+	case DPIPerMonitorV2:
+		return "permonitorv2"
+	case DPIUnaware:
+		return "unaware"
+	}
+	return ""
 }
 
 type appManifestXML struct {
@@ -241,6 +460,9 @@ type appManifestXML struct {
 	Description   string `xml:"description"`
 	Compatibility struct {
 		Application struct {
+			MaxVersionTested struct {
+				Id string `xml:"Id,attr"`
+			} `xml:"maxversiontested"`
 			SupportedOS []struct {
 				Id string `xml:"Id,attr"`
 			} `xml:"supportedOS"`
@@ -259,6 +481,8 @@ type appManifestXML struct {
 			LongPathAware                     string `xml:"longPathAware"`
 			GDIScaling                        string `xml:"gdiScaling"`
 			HeapType                          string `xml:"heapType"`
+			ActiveCodePage                    string `xml:"activeCodePage"`
+			SupportedArchitectures            string `xml:"supportedArchitectures"`
 		} `xml:"windowsSettings"`
 	} `xml:"application"`
 	TrustInfo struct {
@@ -271,21 +495,54 @@ type appManifestXML struct {
 			} `xml:"requestedPrivileges"`
 		} `xml:"security"`
 	} `xml:"trustInfo"`
-	Dependency struct {
+	Dependencies []struct {
 		DependentAssembly []struct {
 			Identity struct {
-				Name           string `xml:"name,attr"`
-				Version        string `xml:"version,attr"`
-				PublicKeyToken string `xml:"publicKeyToken,attr"`
+				Type                  string `xml:"type,attr"`
+				Name                  string `xml:"name,attr"`
+				Version               string `xml:"version,attr"`
+				ProcessorArchitecture string `xml:"processorArchitecture,attr"`
+				PublicKeyToken        string `xml:"publicKeyToken,attr"`
+				Language              string `xml:"language,attr"`
 			} `xml:"assemblyIdentity"`
 		} `xml:"dependentAssembly"`
 	} `xml:"dependency"`
+	Files []struct {
+		Name       string `xml:"name,attr"`
+		COMClasses []struct {
+			CLSID          string `xml:"clsid,attr"`
+			ThreadingModel string `xml:"threadingModel,attr"`
+			ProgID         string `xml:"progid,attr"`
+			TLBID          string `xml:"tlbid,attr"`
+			Description    string `xml:"description,attr"`
+		} `xml:"comClass"`
+		TypeLibs []struct {
+			TLBID      string `xml:"tlbid,attr"`
+			Version    string `xml:"version,attr"`
+			HelpDir    string `xml:"helpdir,attr"`
+			ResourceID string `xml:"resourceid,attr"`
+			Flags      string `xml:"flags,attr"`
+		} `xml:"typelib"`
+		WindowClasses []struct {
+			Name      string `xml:",chardata"`
+			Versioned string `xml:"versioned,attr"`
+		} `xml:"windowClass"`
+	} `xml:"file"`
+	ExternalProxyStubs []struct {
+		IID              string `xml:"iid,attr"`
+		Name             string `xml:"name,attr"`
+		TLBID            string `xml:"tlbid,attr"`
+		ProxyStubCLSID32 string `xml:"proxyStubClsid32,attr"`
+		NumMethods       string `xml:"numMethods,attr"`
+		BaseInterface    string `xml:"baseInterface,attr"`
+	} `xml:"comInterfaceExternalProxyStub"`
 }
 
 // AppManifestFromXML makes an AppManifest from an xml manifest,
 // trying to retrieve as much valid information as possible.
 //
 // If the xml contains other data, they are ignored.
+// Use ManifestDocumentFromXML to keep them.
 //
 // This function can only return xml syntax errors, other errors are ignored.
 func AppManifestFromXML(data []byte) (AppManifest, error) {
@@ -297,29 +554,31 @@ func AppManifestFromXML(data []byte) (AppManifest, error) {
 	var m AppManifest
 
 	m.Identity.Name = x.Identity.Name
-	v := strings.Split(x.Identity.Version, ".")
-	if len(v) > 4 {
-		v = v[:4]
-	}
-	for i := range v {
-		n, _ := strconv.ParseUint(v[i], 10, 16)
-		m.Identity.Version[i] = uint16(n)
-	}
+	m.Identity.Version = readManifestVersion(x.Identity.Version)
 	m.Description = x.Description
 
+	var osList []string
 	m.Compatibility = Win10AndAbove + 1
 	for _, os := range x.Compatibility.Application.SupportedOS {
-		c := osIDToEnum(os.Id)
+		c := osIDToEnum(manifestString(os.Id))
 		if c < m.Compatibility {
 			m.Compatibility = c
 		}
+		if id := strings.TrimSpace(os.Id); isGUID(id) {
+			osList = append(osList, id)
+		}
 	}
 	if m.Compatibility > Win10AndAbove {
 		m.Compatibility = Win7AndAbove
 	}
+	if len(osList) > 0 && !sameOSList(osList, supportedOSList(m.Compatibility, nil)) {
+		m.SupportedOSList = osList
+	}
+	m.MaxVersionTested = strings.TrimSpace(x.Compatibility.Application.MaxVersionTested.Id)
 
 	settings := x.Application.WindowsSettings
 	m.DPIAwareness = readDPIAwareness(settings.DPIAware, settings.DPIAwareness)
+	m.DPIAwarenessFallback = readDPIAwarenessFallback(settings.DPIAwareness)
 	m.AutoElevate = manifestBool(settings.AutoElevate)
 	m.DisableTheming = manifestBool(settings.DisableTheming)
 	m.DisableWindowFiltering = manifestBool(settings.DisableWindowFiltering)
@@ -329,15 +588,57 @@ func AppManifestFromXML(data []byte) (AppManifest, error) {
 	m.LongPathAware = manifestBool(settings.LongPathAware)
 	m.GDIScaling = manifestBool(settings.GDIScaling)
 	m.SegmentHeap = manifestString(settings.HeapType) == "segmentheap"
+	m.ActiveCodePage = readActiveCodePage(settings.ActiveCodePage)
+	if arch := strings.Fields(settings.SupportedArchitectures); len(arch) > 0 {
+		m.SupportedArchitectures = arch
+	}
 
-	for _, dep := range x.Dependency.DependentAssembly {
-		if manifestString(dep.Identity.Name) == "microsoft.windows.common-controls" &&
-			strings.HasPrefix(manifestString(dep.Identity.Version), "6.") &&
-			manifestString(dep.Identity.PublicKeyToken) == "6595b64144ccf1df" {
-			m.UseCommonControlsV6 = true
+	for _, d := range x.Dependencies {
+		for _, dep := range d.DependentAssembly {
+			id := dep.Identity
+			if isCommonControlsV6(id.Name, id.Version, id.PublicKeyToken) {
+				m.UseCommonControlsV6 = true
+				continue
+			}
+			m.Dependencies = append(m.Dependencies, AssemblyIdentity{
+				Name:                  id.Name,
+				Version:               readManifestVersion(strings.TrimSpace(id.Version)),
+				Type:                  id.Type,
+				ProcessorArchitecture: id.ProcessorArchitecture,
+				PublicKeyToken:        id.PublicKeyToken,
+				Language:              id.Language,
+			})
 		}
 	}
 
+	for _, f := range x.Files {
+		file := ManifestFile{Name: f.Name}
+		for _, c := range f.COMClasses {
+			file.COMClasses = append(file.COMClasses, COMClass(c))
+		}
+		for _, tl := range f.TypeLibs {
+			file.TypeLibs = append(file.TypeLibs, TypeLib(tl))
+		}
+		for _, wc := range f.WindowClasses {
+			file.WindowClasses = append(file.WindowClasses, WindowClass{
+				Name:        strings.TrimSpace(wc.Name),
+				Unversioned: manifestString(wc.Versioned) == "no",
+			})
+		}
+		m.Files = append(m.Files, file)
+	}
+	for _, ps := range x.ExternalProxyStubs {
+		n, _ := strconv.Atoi(strings.TrimSpace(ps.NumMethods))
+		m.ExternalProxyStubs = append(m.ExternalProxyStubs, COMInterface{
+			IID:              ps.IID,
+			Name:             ps.Name,
+			TLBID:            ps.TLBID,
+			ProxyStubCLSID32: ps.ProxyStubCLSID32,
+			NumMethods:       n,
+			BaseInterface:    ps.BaseInterface,
+		})
+	}
+
 	m.UIAccess = manifestBool(x.TrustInfo.Security.RequestedPrivileges.RequestedExecutionLevel.UIAccess)
 	switch manifestString(x.TrustInfo.Security.RequestedPrivileges.RequestedExecutionLevel.Level) {
 	case "requireadministrator":
@@ -349,6 +650,27 @@ func AppManifestFromXML(data []byte) (AppManifest, error) {
 	return m, nil
 }
 
+// readManifestVersion reads a version number such as "1.2.3.4", ignoring invalid parts.
+func readManifestVersion(s string) [4]uint16 {
+	var version [4]uint16
+	v := strings.Split(s, ".")
+	if len(v) > 4 {
+		v = v[:4]
+	}
+	for i := range v {
+		n, _ := strconv.ParseUint(v[i], 10, 16)
+		version[i] = uint16(n)
+	}
+	return version
+}
+
+// isCommonControlsV6 tells if a dependency is the one UseCommonControlsV6 stands for.
+func isCommonControlsV6(name, version, publicKeyToken string) bool {
+	return manifestString(name) == "microsoft.windows.common-controls" &&
+		strings.HasPrefix(manifestString(version), "6.") &&
+		manifestString(publicKeyToken) == "6595b64144ccf1df"
+}
+
 func readDPIAwareness(dpiAware string, dpiAwareness string) DPIAwareness {
 	for _, s := range strings.Split(dpiAwareness, ",") {
 		switch manifestString(s) {
@@ -371,6 +693,39 @@ func readDPIAwareness(dpiAware string, dpiAwareness string) DPIAwareness {
 	return DPIUnaware
 }
 
+// readDPIAwarenessFallback returns the values that follow the first valid one in a <dpiAwareness> element.
+//
+// It returns nil when the fallback is the default one.
+func readDPIAwarenessFallback(dpiAwareness string) []DPIAwareness {
+	var list []DPIAwareness
+	for _, s := range strings.Split(dpiAwareness, ",") {
+		switch manifestString(s) {
+		case "permonitorv2":
+			list = append(list, DPIPerMonitorV2)
+		case "permonitor":
+			list = append(list, DPIPerMonitor)
+		case "system":
+			list = append(list, DPIAware)
+		case "unaware":
+			list = append(list, DPIUnaware)
+		}
+	}
+	if len(list) < 2 || len(list) == 2 && list[0] == DPIPerMonitorV2 && list[1] == DPIAware {
+		return nil
+	}
+	return list[1:]
+}
+
+func readActiveCodePage(s string) ActiveCodePage {
+	switch manifestString(s) {
+	case "utf-8":
+		return CodePageUTF8
+	case "legacy":
+		return CodePageLegacy
+	}
+	return ActiveCodePage(strings.TrimSpace(s))
+}
+
 func manifestString(s string) string {
 	return strings.ToLower(strings.TrimSpace(s))
 }
@@ -379,15 +734,55 @@ func manifestBool(s string) bool {
 	return manifestString(s) == "true"
 }
 
+// sameOSList tells if two lists contain the same GUIDs, in any order.
+func sameOSList(a, b []string) bool {
+	set := func(list []string) map[string]bool {
+		m := make(map[string]bool, len(list))
+		for _, id := range list {
+			m[manifestString(id)] = true
+		}
+		return m
+	}
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for id := range sa {
+		if !sb[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// isGUID tells if s is a GUID written between braces, such as "{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}".
+func isGUID(s string) bool {
+	if len(s) != 38 || s[0] != '{' || s[37] != '}' {
+		return false
+	}
+	for i := 1; i < 37; i++ {
+		switch {
+		case i == 9 || i == 14 || i == 19 || i == 24:
+			if s[i] != '-' {
+				return false
+			}
+		case '0' <= s[i] && s[i] <= '9', 'a' <= s[i] && s[i] <= 'f', 'A' <= s[i] && s[i] <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func osIDToEnum(osID string) SupportedOS {
 	switch osID {
-	case osWinVista:
+	case OSWinVista:
 		return WinVistaAndAbove
-	case osWin7:
+	case OSWin7:
 		return Win7AndAbove
-	case osWin8:
+	case OSWin8:
 		return Win8AndAbove
-	case osWin81:
+	case OSWin81:
 		return Win81AndAbove
 	}
 	return Win10AndAbove
@@ -492,16 +887,25 @@ func (level *ExecutionLevel) UnmarshalText(b []byte) error {
 }
 
 type assemblyIdentityJSON struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
+	Name                  string `json:"name"`
+	Version               string `json:"version"`
+	Type                  string `json:"type,omitempty"`
+	ProcessorArchitecture string `json:"processor-architecture,omitempty"`
+	PublicKeyToken        string `json:"public-key-token,omitempty"`
+	Language              string `json:"language,omitempty"`
 }
 
 func (ai AssemblyIdentity) MarshalJSON() ([]byte, error) {
 	if ai.Name == "" {
 		return []byte(`{}`), nil
 	}
-	j := assemblyIdentityJSON{}
-	j.Name = ai.Name
+	j := assemblyIdentityJSON{
+		Name:                  ai.Name,
+		Type:                  ai.Type,
+		ProcessorArchitecture: ai.ProcessorArchitecture,
+		PublicKeyToken:        ai.PublicKeyToken,
+		Language:              ai.Language,
+	}
 	if ai.Name != "" {
 		j.Version = fmt.Sprintf("%d.%d.%d.%d", ai.Version[0], ai.Version[1], ai.Version[2], ai.Version[3])
 	}
@@ -514,6 +918,10 @@ func (ai *AssemblyIdentity) UnmarshalJSON(b []byte) error {
 		return err
 	}
 	ai.Name = j.Name
+	ai.Type = j.Type
+	ai.ProcessorArchitecture = j.ProcessorArchitecture
+	ai.PublicKeyToken = j.PublicKeyToken
+	ai.Language = j.Language
 	j.Version = strings.TrimSpace(j.Version)
 	if j.Version == "" {
 		return nil
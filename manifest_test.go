@@ -1,9 +1,11 @@
 package winres
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -457,6 +459,14 @@ func TestAppManifestFromXML(t *testing.T) {
 				LongPathAware:                     true,
 				GDIScaling:                        true,
 				UseCommonControlsV6:               true,
+				Dependencies: []AssemblyIdentity{{
+					Name:                  "a",
+					Version:               [4]uint16{5, 6, 6, 6},
+					Type:                  "win32",
+					ProcessorArchitecture: "*",
+					PublicKeyToken:        "42",
+					Language:              "*",
+				}},
 			},
 			wantErr: false,
 		},
@@ -558,6 +568,446 @@ func TestAppManifestFromXML(t *testing.T) {
 	}
 }
 
+func TestAppManifest_COM(t *testing.T) {
+	manifest := AppManifest{
+		Identity: AssemblyIdentity{Name: "app", Version: [4]uint16{1}},
+		Files: []ManifestFile{
+			{
+				Name: "server.dll",
+				COMClasses: []COMClass{
+					{
+						CLSID:          "{11111111-1111-1111-1111-111111111111}",
+						ThreadingModel: "Apartment",
+						ProgID:         "App.Server",
+						TLBID:          "{22222222-2222-2222-2222-222222222222}",
+						Description:    "A & B",
+					},
+					{CLSID: "{33333333-3333-3333-3333-333333333333}"},
+				},
+				TypeLibs: []TypeLib{
+					{
+						TLBID:      "{22222222-2222-2222-2222-222222222222}",
+						Version:    "1.0",
+						ResourceID: "1",
+						Flags:      "HASDISKIMAGE",
+					},
+				},
+				WindowClasses: []WindowClass{{Name: "ServerWindow"}, {Name: "Other", Unversioned: true}},
+			},
+			{Name: "empty.dll"},
+		},
+		ExternalProxyStubs: []COMInterface{
+			{
+				IID:              "{44444444-4444-4444-4444-444444444444}",
+				Name:             "IServer",
+				TLBID:            "{22222222-2222-2222-2222-222222222222}",
+				ProxyStubCLSID32: "{00020424-0000-0000-C000-000000000046}",
+				NumMethods:       7,
+				BaseInterface:    "{00000000-0000-0000-C000-000000000046}",
+			},
+			{IID: "{55555555-5555-5555-5555-555555555555}"},
+		},
+	}
+
+	// language=manifest
+	want := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+
+  <assemblyIdentity type="win32" name="app" version="1.0.0.0" processorArchitecture="*"/>
+
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+      <supportedOS Id="{1f676c76-80e1-4239-95bb-83d0f6d0da78}"/>
+      <supportedOS Id="{4a2f28e3-53b9-4441-ba9c-d69d4a4a6e38}"/>
+      <supportedOS Id="{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"/>
+    </application>
+  </compatibility>
+
+  <application xmlns="urn:schemas-microsoft-com:asm.v3">
+    <windowsSettings>
+      <dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true</dpiAware>
+      <dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">system</dpiAwareness>
+    </windowsSettings>
+  </application>
+
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="asInvoker" uiAccess="false"/>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+
+  <file name="server.dll">
+    <comClass clsid="{11111111-1111-1111-1111-111111111111}" threadingModel="Apartment" progid="App.Server" tlbid="{22222222-2222-2222-2222-222222222222}" description="A &amp; B"/>
+    <comClass clsid="{33333333-3333-3333-3333-333333333333}"/>
+    <typelib tlbid="{22222222-2222-2222-2222-222222222222}" version="1.0" helpdir="" resourceid="1" flags="HASDISKIMAGE"/>
+    <windowClass>ServerWindow</windowClass>
+    <windowClass versioned="no">Other</windowClass>
+  </file>
+
+  <file name="empty.dll">
+  </file>
+
+  <comInterfaceExternalProxyStub iid="{44444444-4444-4444-4444-444444444444}" name="IServer" tlbid="{22222222-2222-2222-2222-222222222222}" proxyStubClsid32="{00020424-0000-0000-C000-000000000046}" numMethods="7" baseInterface="{00000000-0000-0000-C000-000000000046}"/>
+  <comInterfaceExternalProxyStub iid="{55555555-5555-5555-5555-555555555555}"/>
+
+</assembly>
+`
+	got := makeManifest(manifest)
+	if string(got) != want {
+		t.Errorf("*** makeManifest():\n%v###\n*** want:\n%v###", string(got), want)
+	}
+
+	m, err := AppManifestFromXML(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, manifest) {
+		t.Errorf("AppManifestFromXML() got = %v, want %v", m, manifest)
+	}
+
+	// language=json
+	wantJSON := `{"identity":{"name":"app","version":"1.0.0.0"},"description":"","minimum-os":"win7","execution-level":"","ui-access":false,"auto-elevate":false,"dpi-awareness":"system","disable-theming":false,"disable-window-filtering":false,"high-resolution-scrolling-aware":false,"ultra-high-resolution-scrolling-aware":false,"long-path-aware":false,"printer-driver-isolation":false,"gdi-scaling":false,"segment-heap":false,"use-common-controls-v6":false,"files":[{"name":"server.dll","com-classes":[{"clsid":"{11111111-1111-1111-1111-111111111111}","threading-model":"Apartment","progid":"App.Server","tlbid":"{22222222-2222-2222-2222-222222222222}","description":"A \u0026 B"},{"clsid":"{33333333-3333-3333-3333-333333333333}"}],"typelibs":[{"tlbid":"{22222222-2222-2222-2222-222222222222}","version":"1.0","help-dir":"","resource-id":"1","flags":"HASDISKIMAGE"}],"window-classes":[{"name":"ServerWindow"},{"name":"Other","unversioned":true}]},{"name":"empty.dll"}],"external-proxy-stubs":[{"iid":"{44444444-4444-4444-4444-444444444444}","name":"IServer","tlbid":"{22222222-2222-2222-2222-222222222222}","proxy-stub-clsid32":"{00020424-0000-0000-C000-000000000046}","num-methods":7,"base-interface":"{00000000-0000-0000-C000-000000000046}"},{"iid":"{55555555-5555-5555-5555-555555555555}"}]}`
+	j, err := json.Marshal(manifest)
+	if err != nil || string(j) != wantJSON {
+		t.Errorf("json.Marshal(AppManifest):\n%s\nwant:\n%s", string(j), wantJSON)
+	}
+	m = AppManifest{}
+	if err = json.Unmarshal(j, &m); err != nil || !reflect.DeepEqual(m, manifest) {
+		t.Errorf("json.Unmarshal(AppManifest) got = %v, want %v", m, manifest)
+	}
+}
+
+func TestAppManifest_Dependencies(t *testing.T) {
+	manifest := AppManifest{
+		Identity:            AssemblyIdentity{Name: "app", Version: [4]uint16{1}},
+		UseCommonControlsV6: true,
+		Dependencies: []AssemblyIdentity{
+			{
+				Name:                  "Microsoft.VC90.CRT",
+				Version:               [4]uint16{9, 0, 21022, 8},
+				Type:                  "win32",
+				ProcessorArchitecture: "amd64",
+				PublicKeyToken:        "1fc8b3b9a1e18e3b",
+			},
+			{
+				Name:                  "Private&Lib",
+				Version:               [4]uint16{1, 2, 3, 4},
+				Type:                  "win32",
+				ProcessorArchitecture: "*",
+				Language:              "*",
+			},
+		},
+	}
+
+	// language=manifest
+	want := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+
+  <assemblyIdentity type="win32" name="app" version="1.0.0.0" processorArchitecture="*"/>
+
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+      <supportedOS Id="{1f676c76-80e1-4239-95bb-83d0f6d0da78}"/>
+      <supportedOS Id="{4a2f28e3-53b9-4441-ba9c-d69d4a4a6e38}"/>
+      <supportedOS Id="{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"/>
+    </application>
+  </compatibility>
+
+  <application xmlns="urn:schemas-microsoft-com:asm.v3">
+    <windowsSettings>
+      <dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true</dpiAware>
+      <dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">system</dpiAwareness>
+    </windowsSettings>
+  </application>
+
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="asInvoker" uiAccess="false"/>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Microsoft.Windows.Common-Controls" version="6.0.0.0" processorArchitecture="*" publicKeyToken="6595b64144ccf1df" language="*"/>
+    </dependentAssembly>
+  </dependency>
+
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Microsoft.VC90.CRT" version="9.0.21022.8" processorArchitecture="amd64" publicKeyToken="1fc8b3b9a1e18e3b"/>
+    </dependentAssembly>
+  </dependency>
+
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Private&amp;Lib" version="1.2.3.4" processorArchitecture="*" language="*"/>
+    </dependentAssembly>
+  </dependency>
+
+</assembly>
+`
+	got := makeManifest(manifest)
+	if string(got) != want {
+		t.Errorf("*** makeManifest():\n%v###\n*** want:\n%v###", string(got), want)
+	}
+
+	m, err := AppManifestFromXML(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, manifest) {
+		t.Errorf("AppManifestFromXML() got = %v, want %v", m, manifest)
+	}
+
+	// language=json
+	wantJSON := `{"identity":{"name":"app","version":"1.0.0.0"},"description":"","minimum-os":"win7","execution-level":"","ui-access":false,"auto-elevate":false,"dpi-awareness":"system","disable-theming":false,"disable-window-filtering":false,"high-resolution-scrolling-aware":false,"ultra-high-resolution-scrolling-aware":false,"long-path-aware":false,"printer-driver-isolation":false,"gdi-scaling":false,"segment-heap":false,"use-common-controls-v6":true,"dependencies":[{"name":"Microsoft.VC90.CRT","version":"9.0.21022.8","type":"win32","processor-architecture":"amd64","public-key-token":"1fc8b3b9a1e18e3b"},{"name":"Private\u0026Lib","version":"1.2.3.4","type":"win32","processor-architecture":"*","language":"*"}]}`
+	j, err := json.Marshal(manifest)
+	if err != nil || string(j) != wantJSON {
+		t.Errorf("json.Marshal(AppManifest):\n%s\nwant:\n%s", string(j), wantJSON)
+	}
+	m = AppManifest{}
+	if err = json.Unmarshal(j, &m); err != nil || !reflect.DeepEqual(m, manifest) {
+		t.Errorf("json.Unmarshal(AppManifest) got = %v, want %v", m, manifest)
+	}
+}
+
+func TestAppManifest_DependencyDefaults(t *testing.T) {
+	got := makeManifest(AppManifest{Dependencies: []AssemblyIdentity{{Name: "lib", Version: [4]uint16{2}}}})
+	want := `<assemblyIdentity type="win32" name="lib" version="2.0.0.0" processorArchitecture="*"/>`
+	if !bytes.Contains(got, []byte(want)) {
+		t.Errorf("makeManifest() doesn't contain %s:\n%s", want, got)
+	}
+}
+
+func TestAppManifest_ModernSettings(t *testing.T) {
+	manifest := AppManifest{
+		DPIAwareness:           DPIPerMonitorV2,
+		DPIAwarenessFallback:   []DPIAwareness{DPIPerMonitor, DPIUnaware},
+		ActiveCodePage:         CodePageUTF8,
+		SupportedArchitectures: []string{"amd64", "arm64"},
+	}
+
+	// language=manifest
+	want := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+      <supportedOS Id="{1f676c76-80e1-4239-95bb-83d0f6d0da78}"/>
+      <supportedOS Id="{4a2f28e3-53b9-4441-ba9c-d69d4a4a6e38}"/>
+      <supportedOS Id="{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"/>
+    </application>
+  </compatibility>
+
+  <application xmlns="urn:schemas-microsoft-com:asm.v3">
+    <windowsSettings>
+      <dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true</dpiAware>
+      <dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">permonitorv2,permonitor,unaware</dpiAwareness>
+      <activeCodePage xmlns="http://schemas.microsoft.com/SMI/2019/WindowsSettings">UTF-8</activeCodePage>
+      <supportedArchitectures xmlns="http://schemas.microsoft.com/SMI/2024/WindowsSettings">amd64 arm64</supportedArchitectures>
+    </windowsSettings>
+  </application>
+
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="asInvoker" uiAccess="false"/>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+
+</assembly>
+`
+	got := makeManifest(manifest)
+	if string(got) != want {
+		t.Errorf("*** makeManifest():\n%v###\n*** want:\n%v###", string(got), want)
+	}
+
+	m, err := AppManifestFromXML(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, manifest) {
+		t.Errorf("AppManifestFromXML() got = %v, want %v", m, manifest)
+	}
+
+	// language=json
+	wantJSON := `{"identity":{},"description":"","minimum-os":"win7","execution-level":"","ui-access":false,"auto-elevate":false,"dpi-awareness":"per monitor v2","dpi-awareness-fallback":["per monitor","unaware"],"disable-theming":false,"disable-window-filtering":false,"high-resolution-scrolling-aware":false,"ultra-high-resolution-scrolling-aware":false,"long-path-aware":false,"printer-driver-isolation":false,"gdi-scaling":false,"segment-heap":false,"active-code-page":"UTF-8","supported-architectures":["amd64","arm64"],"use-common-controls-v6":false}`
+	j, err := json.Marshal(manifest)
+	if err != nil || string(j) != wantJSON {
+		t.Errorf("json.Marshal(AppManifest):\n%s\nwant:\n%s", string(j), wantJSON)
+	}
+	m = AppManifest{}
+	if err = json.Unmarshal(j, &m); err != nil || !reflect.DeepEqual(m, manifest) {
+		t.Errorf("json.Unmarshal(AppManifest) got = %v, want %v", m, manifest)
+	}
+}
+
+func TestAppManifestFromXML_ModernSettings(t *testing.T) {
+	tests := []struct {
+		name             string
+		dpiAwareness     string
+		activeCodePage   string
+		architectures    string
+		wantFallback     []DPIAwareness
+		wantCodePage     ActiveCodePage
+		wantArchitecture []string
+	}{
+		{name: "default", dpiAwareness: "PerMonitorV2, System"},
+		{name: "single", dpiAwareness: "permonitor", activeCodePage: " legacy ", wantCodePage: CodePageLegacy},
+		{
+			name:             "custom",
+			dpiAwareness:     "unknown, system, permonitorv2 ,, unaware",
+			activeCodePage:   "utf-8",
+			architectures:    " arm64\n  amd64 ",
+			wantFallback:     []DPIAwareness{DPIPerMonitorV2, DPIUnaware},
+			wantCodePage:     CodePageUTF8,
+			wantArchitecture: []string{"arm64", "amd64"},
+		},
+		{name: "locale", activeCodePage: " en-US ", wantCodePage: "en-US"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// language=manifest
+			xml := `<assembly><application><windowsSettings>
+<dpiAwareness>` + tt.dpiAwareness + `</dpiAwareness>
+<activeCodePage>` + tt.activeCodePage + `</activeCodePage>
+<supportedArchitectures>` + tt.architectures + `</supportedArchitectures>
+</windowsSettings></application></assembly>`
+			m, err := AppManifestFromXML([]byte(xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(m.DPIAwarenessFallback, tt.wantFallback) {
+				t.Errorf("DPIAwarenessFallback = %v, want %v", m.DPIAwarenessFallback, tt.wantFallback)
+			}
+			if m.ActiveCodePage != tt.wantCodePage {
+				t.Errorf("ActiveCodePage = %q, want %q", m.ActiveCodePage, tt.wantCodePage)
+			}
+			if !reflect.DeepEqual(m.SupportedArchitectures, tt.wantArchitecture) {
+				t.Errorf("SupportedArchitectures = %v, want %v", m.SupportedArchitectures, tt.wantArchitecture)
+			}
+		})
+	}
+}
+
+func TestAppManifest_SupportedOSList(t *testing.T) {
+	manifest := AppManifest{
+		SupportedOSList:  []string{OSWin10, OSWin7},
+		MaxVersionTested: "10.0.22621.0",
+	}
+
+	// language=manifest
+	want := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <maxversiontested Id="10.0.22621.0"/>
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+      <supportedOS Id="{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"/>
+    </application>
+  </compatibility>
+
+  <application xmlns="urn:schemas-microsoft-com:asm.v3">
+    <windowsSettings>
+      <dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true</dpiAware>
+      <dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">system</dpiAwareness>
+    </windowsSettings>
+  </application>
+
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="asInvoker" uiAccess="false"/>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+
+</assembly>
+`
+	got := makeManifest(manifest)
+	if string(got) != want {
+		t.Errorf("*** makeManifest():\n%v###\n*** want:\n%v###", string(got), want)
+	}
+
+	// The list is kept because Win7AndAbove would also declare Windows 8 and 8.1
+	m, err := AppManifestFromXML(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m, manifest) {
+		t.Errorf("AppManifestFromXML() got = %v, want %v", m, manifest)
+	}
+
+	// language=json
+	wantJSON := `{"identity":{},"description":"","minimum-os":"win7","supported-os":["{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}","{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"],"max-version-tested":"10.0.22621.0","execution-level":"","ui-access":false,"auto-elevate":false,"dpi-awareness":"system","disable-theming":false,"disable-window-filtering":false,"high-resolution-scrolling-aware":false,"ultra-high-resolution-scrolling-aware":false,"long-path-aware":false,"printer-driver-isolation":false,"gdi-scaling":false,"segment-heap":false,"use-common-controls-v6":false}`
+	j, err := json.Marshal(manifest)
+	if err != nil || string(j) != wantJSON {
+		t.Errorf("json.Marshal(AppManifest):\n%s\nwant:\n%s", string(j), wantJSON)
+	}
+	m = AppManifest{}
+	if err = json.Unmarshal(j, &m); err != nil || !reflect.DeepEqual(m, manifest) {
+		t.Errorf("json.Unmarshal(AppManifest) got = %v, want %v", m, manifest)
+	}
+}
+
+func TestAppManifest_SupportedOSList_Invalid(t *testing.T) {
+	manifest := AppManifest{
+		Compatibility:   Win81AndAbove,
+		SupportedOSList: []string{`"/><evil/><x y="`, "win10"},
+	}
+	got := string(makeManifest(manifest))
+	if strings.Contains(got, "evil") || strings.Contains(got, "win10") || strings.Count(got, "<supportedOS ") != 2 {
+		t.Errorf("entries that are not GUIDs should be dropped:\n%s", got)
+	}
+
+	manifest.SupportedOSList = append(manifest.SupportedOSList, "{00000000-0000-0000-0000-00000000000A}")
+	got = string(makeManifest(manifest))
+	if !strings.Contains(got, `<supportedOS Id="{00000000-0000-0000-0000-00000000000A}"/>`) || strings.Count(got, "<supportedOS ") != 1 {
+		t.Errorf("GUIDs should be kept:\n%s", got)
+	}
+
+}
+
+func TestAppManifest_SupportedOSList_CustomGUID(t *testing.T) {
+	manifest := AppManifest{SupportedOSList: []string{"{11111111-2222-3333-4444-555555555555}", OSWin10}}
+	m, err := AppManifestFromXML(makeManifest(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Compatibility = Win10AndAbove
+	if !reflect.DeepEqual(m, manifest) {
+		t.Errorf("AppManifestFromXML() got = %v, want %v", m, manifest)
+	}
+}
+
+func TestAppManifestFromXML_SupportedOSList(t *testing.T) {
+	// language=manifest
+	xml := `<assembly><compatibility><application>
+<supportedOS Id=" {35138B9A-5D96-4FBD-8E2D-A2440225F93A} "/>
+<supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+<supportedOS Id="{4a2f28e3-53b9-4441-ba9c-d69d4a4a6e38}"/>
+<supportedOS Id="{1f676c76-80e1-4239-95bb-83d0f6d0da78}"/>
+<maxversiontested Id=" 10.0.18362.1 "/>
+</application></compatibility></assembly>`
+	m, err := AppManifestFromXML([]byte(xml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := AppManifest{MaxVersionTested: "10.0.18362.1", DPIAwareness: DPIUnaware}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("AppManifestFromXML() got = %v, want %v", m, want)
+	}
+}
+
 func Test_readDPIAwareness(t *testing.T) {
 	type args struct {
 		dpiAware     string
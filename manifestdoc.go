@@ -0,0 +1,695 @@
+package winres
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ManifestDocument is an application manifest that keeps its original xml.
+//
+// It exposes the same fields as AppManifest. When a field is modified, Bytes only rewrites
+// the matching elements and attributes. Everything else is kept as is,
+// including elements unknown to AppManifest, namespaces and comments.
+//
+// It must be created by ManifestDocumentFromXML.
+type ManifestDocument struct {
+	AppManifest
+	original AppManifest
+	nodes    []xmlNode
+	root     *xmlElement
+}
+
+const (
+	nsAsmV3         = "urn:schemas-microsoft-com:asm.v3"
+	nsCompatibility = "urn:schemas-microsoft-com:compatibility.v1"
+	nsSettings2005  = "http://schemas.microsoft.com/SMI/2005/WindowsSettings"
+	nsSettings2011  = "http://schemas.microsoft.com/SMI/2011/WindowsSettings"
+	nsSettings2013  = "http://schemas.microsoft.com/SMI/2013/WindowsSettings"
+	nsSettings2016  = "http://schemas.microsoft.com/SMI/2016/WindowsSettings"
+	nsSettings2017  = "http://schemas.microsoft.com/SMI/2017/WindowsSettings"
+	nsSettings2019  = "http://schemas.microsoft.com/SMI/2019/WindowsSettings"
+	nsSettings2020  = "http://schemas.microsoft.com/SMI/2020/WindowsSettings"
+	nsSettings2024  = "http://schemas.microsoft.com/SMI/2024/WindowsSettings"
+)
+
+// ManifestDocumentFromXML loads an xml manifest, so it can be modified without losing information.
+//
+// Its fields are read as in AppManifestFromXML.
+func ManifestDocumentFromXML(data []byte) (*ManifestDocument, error) {
+	m, err := AppManifestFromXML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := parseXMLNodes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &ManifestDocument{
+		AppManifest: m,
+		original:    m.clone(),
+		nodes:       nodes,
+	}
+	for _, n := range nodes {
+		if e, ok := n.(*xmlElement); ok {
+			doc.root = e
+			break
+		}
+	}
+
+	return doc, nil
+}
+
+// Bytes returns the xml manifest, with the modifications made to its fields.
+func (doc *ManifestDocument) Bytes() []byte {
+	doc.update()
+	doc.original = doc.AppManifest.clone()
+
+	buf := &bytes.Buffer{}
+	for _, n := range doc.nodes {
+		writeXMLNode(buf, n)
+	}
+	return buf.Bytes()
+}
+
+// SetManifestDocument embeds an application manifest that was loaded by ManifestDocumentFromXML.
+func (rs *ResourceSet) SetManifestDocument(doc *ManifestDocument) {
+	rs.Set(RT_MANIFEST, ID(1), LCIDDefault, doc.Bytes())
+}
+
+// clone returns a copy of the manifest that shares no slice with it,
+// so that elements modified in place are detected by ManifestDocument.update.
+func (m AppManifest) clone() AppManifest {
+	c := m
+	if m.SupportedOSList != nil {
+		c.SupportedOSList = append(make([]string, 0, len(m.SupportedOSList)), m.SupportedOSList...)
+	}
+	if m.DPIAwarenessFallback != nil {
+		c.DPIAwarenessFallback = append(make([]DPIAwareness, 0, len(m.DPIAwarenessFallback)), m.DPIAwarenessFallback...)
+	}
+	if m.SupportedArchitectures != nil {
+		c.SupportedArchitectures = append(make([]string, 0, len(m.SupportedArchitectures)), m.SupportedArchitectures...)
+	}
+	if m.Dependencies != nil {
+		c.Dependencies = append(make([]AssemblyIdentity, 0, len(m.Dependencies)), m.Dependencies...)
+	}
+	if m.ExternalProxyStubs != nil {
+		c.ExternalProxyStubs = append(make([]COMInterface, 0, len(m.ExternalProxyStubs)), m.ExternalProxyStubs...)
+	}
+	if m.Files != nil {
+		c.Files = make([]ManifestFile, len(m.Files))
+		for i, f := range m.Files {
+			c.Files[i] = f
+			if f.COMClasses != nil {
+				c.Files[i].COMClasses = append(make([]COMClass, 0, len(f.COMClasses)), f.COMClasses...)
+			}
+			if f.TypeLibs != nil {
+				c.Files[i].TypeLibs = append(make([]TypeLib, 0, len(f.TypeLibs)), f.TypeLibs...)
+			}
+			if f.WindowClasses != nil {
+				c.Files[i].WindowClasses = append(make([]WindowClass, 0, len(f.WindowClasses)), f.WindowClasses...)
+			}
+		}
+	}
+	return c
+}
+
+// update rewrites the parts of the xml tree that match modified fields.
+func (doc *ManifestDocument) update() {
+	var (
+		m    = &doc.AppManifest
+		orig = &doc.original
+		root = doc.root
+	)
+
+	if m.Identity != orig.Identity {
+		if m.Identity.Name == "" {
+			root.removeChildren("assemblyIdentity")
+		} else {
+			ai := root.child("assemblyIdentity")
+			if ai == nil {
+				ai = root.newChild("assemblyIdentity", "")
+				root.insertChild(ai, 0)
+			}
+			// Attributes that AppManifestFromXML does not read are only overwritten when they are set
+			attrs := makeAssemblyIdentityAttrs(m.Identity)
+			if m.Identity.Type != "" || ai.attr("type") == nil {
+				ai.setAttr("type", attrs.Type)
+			}
+			ai.setAttr("name", attrs.Name)
+			ai.setAttr("version", attrs.Version)
+			if m.Identity.ProcessorArchitecture != "" || ai.attr("processorArchitecture") == nil {
+				ai.setAttr("processorArchitecture", attrs.ProcessorArchitecture)
+			}
+			if attrs.PublicKeyToken != "" {
+				ai.setAttr("publicKeyToken", attrs.PublicKeyToken)
+			}
+			if attrs.Language != "" {
+				ai.setAttr("language", attrs.Language)
+			}
+		}
+	}
+
+	if m.Description != orig.Description {
+		if m.Description == "" {
+			root.removeChildren("description")
+		} else {
+			d := root.child("description")
+			if d == nil {
+				d = root.newChild("description", "")
+				root.insertChild(d, root.indexAfter("assemblyIdentity"))
+			}
+			d.setText(m.Description)
+		}
+	}
+
+	if m.MaxVersionTested != orig.MaxVersionTested {
+		if m.MaxVersionTested == "" {
+			if c := root.child("compatibility"); c != nil {
+				if app := c.child("application"); app != nil {
+					app.removeChildren("maxversiontested")
+				}
+			}
+		} else {
+			app := root.ensureChild("compatibility", nsCompatibility).ensureChild("application", "")
+			mvt := app.child("maxversiontested")
+			if mvt == nil {
+				mvt = app.newChild("maxversiontested", "")
+				app.insertChild(mvt, 0)
+			}
+			mvt.setAttr("Id", m.MaxVersionTested)
+		}
+	}
+
+	if m.Compatibility != orig.Compatibility || !reflect.DeepEqual(m.SupportedOSList, orig.SupportedOSList) {
+		app := root.ensureChild("compatibility", nsCompatibility).ensureChild("application", "")
+		app.removeChildren("supportedOS")
+		i := app.indexAfter("maxversiontested")
+		for _, osID := range supportedOSList(m.Compatibility, m.SupportedOSList) {
+			os := app.newChild("supportedOS", "")
+			os.setAttr("Id", osID)
+			app.insertChild(os, i)
+			i++
+		}
+	}
+
+	doc.updateSettings()
+
+	if m.ExecutionLevel != orig.ExecutionLevel || m.UIAccess != orig.UIAccess {
+		rel := root.ensureChild("trustInfo", nsAsmV3).
+			ensureChild("security", "").
+			ensureChild("requestedPrivileges", "").
+			ensureChild("requestedExecutionLevel", "")
+		rel.setAttr("level", executionLevelString(m.ExecutionLevel))
+		rel.setAttr("uiAccess", fmt.Sprint(m.UIAccess))
+	}
+
+	if m.UseCommonControlsV6 != orig.UseCommonControlsV6 {
+		if m.UseCommonControlsV6 {
+			dep := root.ensureChild("dependency", "")
+			dep.insertChild(dep.newDependentAssembly(AssemblyIdentity{
+				Name:           "Microsoft.Windows.Common-Controls",
+				Version:        [4]uint16{6, 0, 0, 0},
+				PublicKeyToken: "6595b64144ccf1df",
+				Language:       "*",
+			}), -1)
+		} else {
+			root.removeDependentAssemblies(isCommonControlsV6Element)
+		}
+	}
+
+	// Other dependencies are rewritten as a whole, keeping Common Controls
+	if !reflect.DeepEqual(m.Dependencies, orig.Dependencies) {
+		i := root.index("dependency")
+		root.removeDependentAssemblies(func(da *xmlElement) bool { return !isCommonControlsV6Element(da) })
+		if j := root.index("dependency"); j >= 0 {
+			i = j + len(root.children("dependency"))
+		}
+		for _, ai := range m.Dependencies {
+			dep := root.newChild("dependency", "")
+			dep.insertChild(dep.newDependentAssembly(ai), -1)
+			root.insertChild(dep, i)
+			if i >= 0 {
+				i++
+			}
+		}
+	}
+
+	// Files and proxy stubs are rewritten as a whole, where the first one was
+	if !reflect.DeepEqual(m.Files, orig.Files) {
+		i := root.index("file")
+		root.removeChildren("file")
+		for _, f := range m.Files {
+			root.insertChild(root.newFile(f), i)
+			if i >= 0 {
+				i++
+			}
+		}
+	}
+	if !reflect.DeepEqual(m.ExternalProxyStubs, orig.ExternalProxyStubs) {
+		i := root.index("comInterfaceExternalProxyStub")
+		root.removeChildren("comInterfaceExternalProxyStub")
+		for _, ps := range m.ExternalProxyStubs {
+			root.insertChild(root.newExternalProxyStub(ps), i)
+			if i >= 0 {
+				i++
+			}
+		}
+	}
+}
+
+// newDependentAssembly makes a <dependentAssembly> element that can be inserted into e.
+func (e *xmlElement) newDependentAssembly(ai AssemblyIdentity) *xmlElement {
+	attrs := makeAssemblyIdentityAttrs(ai)
+	da := e.newChild("dependentAssembly", "")
+	id := da.newChild("assemblyIdentity", "")
+	id.setAttr("type", attrs.Type)
+	id.setAttr("name", attrs.Name)
+	id.setAttr("version", attrs.Version)
+	id.setAttr("processorArchitecture", attrs.ProcessorArchitecture)
+	id.setOptionalAttr("publicKeyToken", attrs.PublicKeyToken)
+	id.setOptionalAttr("language", attrs.Language)
+	da.insertChild(id, -1)
+	return da
+}
+
+// removeDependentAssemblies removes the <dependentAssembly> elements that satisfy f,
+// and the <dependency> elements they leave empty.
+func (e *xmlElement) removeDependentAssemblies(f func(da *xmlElement) bool) {
+	for _, dep := range e.children("dependency") {
+		dep.removeChildrenFunc("dependentAssembly", f)
+		if len(dep.children("dependentAssembly")) == 0 {
+			e.removeChildrenFunc("dependency", func(c *xmlElement) bool { return c == dep })
+		}
+	}
+}
+
+func isCommonControlsV6Element(da *xmlElement) bool {
+	ai := da.child("assemblyIdentity")
+	return ai != nil && isCommonControlsV6(ai.attrValue("name"), ai.attrValue("version"), ai.attrValue("publicKeyToken"))
+}
+
+// newFile makes a <file> element that can be inserted into e.
+func (e *xmlElement) newFile(f ManifestFile) *xmlElement {
+	file := e.newChild("file", "")
+	file.setAttr("name", f.Name)
+
+	for _, c := range f.COMClasses {
+		cc := file.newChild("comClass", "")
+		cc.setAttr("clsid", c.CLSID)
+		cc.setOptionalAttr("threadingModel", c.ThreadingModel)
+		cc.setOptionalAttr("progid", c.ProgID)
+		cc.setOptionalAttr("tlbid", c.TLBID)
+		cc.setOptionalAttr("description", c.Description)
+		file.insertChild(cc, -1)
+	}
+	for _, tl := range f.TypeLibs {
+		t := file.newChild("typelib", "")
+		t.setAttr("tlbid", tl.TLBID)
+		t.setAttr("version", tl.Version)
+		t.setAttr("helpdir", tl.HelpDir)
+		t.setOptionalAttr("resourceid", tl.ResourceID)
+		t.setOptionalAttr("flags", tl.Flags)
+		file.insertChild(t, -1)
+	}
+	for _, wc := range f.WindowClasses {
+		w := file.newChild("windowClass", "")
+		if wc.Unversioned {
+			w.setAttr("versioned", "no")
+		}
+		w.setText(wc.Name)
+		file.insertChild(w, -1)
+	}
+
+	return file
+}
+
+// newExternalProxyStub makes a <comInterfaceExternalProxyStub> element that can be inserted into e.
+func (e *xmlElement) newExternalProxyStub(ps COMInterface) *xmlElement {
+	c := e.newChild("comInterfaceExternalProxyStub", "")
+	c.setAttr("iid", ps.IID)
+	c.setOptionalAttr("name", ps.Name)
+	c.setOptionalAttr("tlbid", ps.TLBID)
+	c.setOptionalAttr("proxyStubClsid32", ps.ProxyStubCLSID32)
+	if ps.NumMethods != 0 {
+		c.setAttr("numMethods", strconv.Itoa(ps.NumMethods))
+	}
+	c.setOptionalAttr("baseInterface", ps.BaseInterface)
+	return c
+}
+
+// updateSettings rewrites the modified elements of <windowsSettings>.
+func (doc *ManifestDocument) updateSettings() {
+	var (
+		m    = &doc.AppManifest
+		orig = &doc.original
+	)
+
+	settings := func() *xmlElement {
+		return doc.root.ensureChild("application", nsAsmV3).ensureChild("windowsSettings", "")
+	}
+	set := func(name, ns string, value string) {
+		if value == "" {
+			if app := doc.root.child("application"); app != nil {
+				if ws := app.child("windowsSettings"); ws != nil {
+					ws.removeChildren(name)
+				}
+			}
+			return
+		}
+		settings().ensureChild(name, ns).setText(value)
+	}
+	setBool := func(name, ns string, value, origValue bool) {
+		if value == origValue {
+			return
+		}
+		if value {
+			set(name, ns, "true")
+		} else {
+			set(name, ns, "")
+		}
+	}
+
+	if m.DPIAwareness != orig.DPIAwareness || !reflect.DeepEqual(m.DPIAwarenessFallback, orig.DPIAwarenessFallback) {
+		dpiAware, dpiAwareness := dpiAwarenessStrings(m.DPIAwareness, m.DPIAwarenessFallback)
+		set("dpiAware", nsSettings2005, dpiAware)
+		set("dpiAwareness", nsSettings2016, dpiAwareness)
+	}
+	setBool("autoElevate", nsSettings2005, m.AutoElevate, orig.AutoElevate)
+	setBool("disableTheming", nsSettings2005, m.DisableTheming, orig.DisableTheming)
+	setBool("disableWindowFiltering", nsSettings2011, m.DisableWindowFiltering, orig.DisableWindowFiltering)
+	setBool("highResolutionScrollingAware", nsSettings2013, m.HighResolutionScrollingAware, orig.HighResolutionScrollingAware)
+	setBool("printerDriverIsolation", nsSettings2011, m.PrinterDriverIsolation, orig.PrinterDriverIsolation)
+	setBool("ultraHighResolutionScrollingAware", nsSettings2013, m.UltraHighResolutionScrollingAware, orig.UltraHighResolutionScrollingAware)
+	setBool("longPathAware", nsSettings2016, m.LongPathAware, orig.LongPathAware)
+	setBool("gdiScaling", nsSettings2017, m.GDIScaling, orig.GDIScaling)
+	if m.SegmentHeap != orig.SegmentHeap {
+		if m.SegmentHeap {
+			set("heapType", nsSettings2020, "SegmentHeap")
+		} else {
+			set("heapType", nsSettings2020, "")
+		}
+	}
+	if m.ActiveCodePage != orig.ActiveCodePage {
+		set("activeCodePage", nsSettings2019, string(m.ActiveCodePage))
+	}
+	if !reflect.DeepEqual(m.SupportedArchitectures, orig.SupportedArchitectures) {
+		set("supportedArchitectures", nsSettings2024, strings.Join(m.SupportedArchitectures, " "))
+	}
+}
+
+// xmlNode is one of: *xmlElement, xml.CharData, xml.Comment, xml.ProcInst, xml.Directive
+type xmlNode interface{}
+
+// xmlElement is an element of an xml tree, as read by xml.Decoder.RawToken.
+//
+// Names are not resolved, their Space is the prefix, so that they can be written back as is.
+type xmlElement struct {
+	name        xml.Name
+	attrs       []xml.Attr
+	nodes       []xmlNode
+	selfClosing bool
+	// indent is the whitespace that precedes the element on its line
+	indent string
+}
+
+func parseXMLNodes(data []byte) ([]xmlNode, error) {
+	var (
+		d     = xml.NewDecoder(bytes.NewReader(data))
+		top   []xmlNode
+		stack []*xmlElement
+	)
+
+	add := func(n xmlNode) {
+		if len(stack) == 0 {
+			top = append(top, n)
+			return
+		}
+		e := stack[len(stack)-1]
+		e.nodes = append(e.nodes, n)
+	}
+
+	for {
+		offset := d.InputOffset()
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &xmlElement{
+				name:   t.Name,
+				attrs:  append([]xml.Attr{}, t.Attr...),
+				indent: lineIndent(data[:offset]),
+			}
+			add(e)
+			stack = append(stack, e)
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1].name != t.Name {
+				return nil, &xml.SyntaxError{Msg: "unexpected end element </" + t.Name.Local + ">"}
+			}
+			e := stack[len(stack)-1]
+			// The decoder makes up an end element for <element/>, without consuming input
+			e.selfClosing = len(e.nodes) == 0 && d.InputOffset() == offset
+			stack = stack[:len(stack)-1]
+		default:
+			add(xml.CopyToken(tok))
+		}
+	}
+
+	return top, nil
+}
+
+// lineIndent returns the whitespace at the end of data, if it starts a line.
+func lineIndent(data []byte) string {
+	i := len(data)
+	for i > 0 && (data[i-1] == ' ' || data[i-1] == '\t') {
+		i--
+	}
+	if i > 0 && data[i-1] != '\n' {
+		return ""
+	}
+	return string(data[i:])
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\n", "&#xA;", "\r", "&#xD;", "\t", "&#x9;")
+)
+
+func xmlQualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+func writeXMLNode(buf *bytes.Buffer, n xmlNode) {
+	switch n := n.(type) {
+	case *xmlElement:
+		buf.WriteString("<" + xmlQualifiedName(n.name))
+		for _, a := range n.attrs {
+			buf.WriteString(" " + xmlQualifiedName(a.Name) + `="` + xmlAttrEscaper.Replace(a.Value) + `"`)
+		}
+		if len(n.nodes) == 0 && n.selfClosing {
+			buf.WriteString("/>")
+			return
+		}
+		buf.WriteString(">")
+		for _, c := range n.nodes {
+			writeXMLNode(buf, c)
+		}
+		buf.WriteString("</" + xmlQualifiedName(n.name) + ">")
+	case xml.CharData:
+		buf.WriteString(xmlTextEscaper.Replace(string(n)))
+	case xml.Comment:
+		buf.WriteString("<!--" + string(n) + "-->")
+	case xml.ProcInst:
+		buf.WriteString("<?" + n.Target)
+		if len(n.Inst) > 0 {
+			buf.WriteString(" " + string(n.Inst))
+		}
+		buf.WriteString("?>")
+	case xml.Directive:
+		buf.WriteString("<!" + string(n) + ">")
+	}
+}
+
+// children returns the child elements that have a given local name, whatever their namespace.
+func (e *xmlElement) children(local string) []*xmlElement {
+	var list []*xmlElement
+	for _, n := range e.nodes {
+		if c, ok := n.(*xmlElement); ok && c.name.Local == local {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+// child returns the first child element that has a given local name, or nil.
+func (e *xmlElement) child(local string) *xmlElement {
+	if list := e.children(local); len(list) > 0 {
+		return list[0]
+	}
+	return nil
+}
+
+// ensureChild returns the first child element that has a given local name, creating it if needed.
+func (e *xmlElement) ensureChild(local, ns string) *xmlElement {
+	if c := e.child(local); c != nil {
+		return c
+	}
+	c := e.newChild(local, ns)
+	e.insertChild(c, -1)
+	return c
+}
+
+// newChild makes an element that can be inserted into e.
+//
+// If ns is empty, the element is in the same namespace as e.
+func (e *xmlElement) newChild(local, ns string) *xmlElement {
+	c := &xmlElement{
+		name:        xml.Name{Local: local},
+		selfClosing: true,
+		indent:      e.indent + "  ",
+	}
+	if ns != "" {
+		c.attrs = []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: ns}}
+	} else {
+		c.name.Space = e.name.Space
+	}
+	return c
+}
+
+// insertChild inserts an element on its own line, before the i-th child element, or at the end if i < 0.
+func (e *xmlElement) insertChild(c *xmlElement, i int) {
+	if len(e.nodes) == 0 {
+		e.nodes = []xmlNode{xml.CharData("\n" + c.indent), c, xml.CharData("\n" + e.indent)}
+		return
+	}
+
+	pos := len(e.nodes)
+	if isWhitespace(e.nodes[pos-1]) {
+		pos--
+	}
+	for j, n := range e.nodes {
+		if _, ok := n.(*xmlElement); ok {
+			if i == 0 {
+				pos = j
+				if j > 0 && isWhitespace(e.nodes[j-1]) {
+					pos--
+				}
+				break
+			}
+			i--
+		}
+	}
+
+	e.nodes = append(e.nodes[:pos], append([]xmlNode{xml.CharData("\n" + c.indent), c}, e.nodes[pos:]...)...)
+}
+
+// index returns the index of the first child element named local, among child elements, or -1.
+func (e *xmlElement) index(local string) int {
+	i := 0
+	for _, n := range e.nodes {
+		if c, ok := n.(*xmlElement); ok {
+			if c.name.Local == local {
+				return i
+			}
+			i++
+		}
+	}
+	return -1
+}
+
+// indexAfter returns the index of the child element that follows the first element named local, or 0.
+func (e *xmlElement) indexAfter(local string) int {
+	i := 0
+	for _, n := range e.nodes {
+		if c, ok := n.(*xmlElement); ok {
+			i++
+			if c.name.Local == local {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// removeChildren removes the child elements that have a given local name, along with their indentation.
+func (e *xmlElement) removeChildren(local string) {
+	e.removeChildrenFunc(local, func(*xmlElement) bool { return true })
+}
+
+// removeChildrenFunc removes the child elements that have a given local name and satisfy f.
+func (e *xmlElement) removeChildrenFunc(local string, f func(c *xmlElement) bool) {
+	nodes := e.nodes[:0]
+	for _, n := range e.nodes {
+		if c, ok := n.(*xmlElement); ok && c.name.Local == local && f(c) {
+			if len(nodes) > 0 && isWhitespace(nodes[len(nodes)-1]) {
+				nodes = nodes[:len(nodes)-1]
+			}
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	e.nodes = nodes
+}
+
+func (e *xmlElement) setText(s string) {
+	e.nodes = []xmlNode{xml.CharData(s)}
+}
+
+func (e *xmlElement) attr(local string) *xml.Attr {
+	for i := range e.attrs {
+		if e.attrs[i].Name.Local == local && e.attrs[i].Name.Space == "" {
+			return &e.attrs[i]
+		}
+	}
+	return nil
+}
+
+func (e *xmlElement) attrValue(local string) string {
+	if a := e.attr(local); a != nil {
+		return a.Value
+	}
+	return ""
+}
+
+// setOptionalAttr sets an attribute, or removes it if value is empty.
+func (e *xmlElement) setOptionalAttr(local, value string) {
+	if value != "" {
+		e.setAttr(local, value)
+		return
+	}
+	attrs := e.attrs[:0]
+	for _, a := range e.attrs {
+		if a.Name.Local != local || a.Name.Space != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	e.attrs = attrs
+}
+
+func (e *xmlElement) setAttr(local, value string) {
+	if a := e.attr(local); a != nil {
+		a.Value = value
+		return
+	}
+	e.attrs = append(e.attrs, xml.Attr{Name: xml.Name{Local: local}, Value: value})
+}
+
+func isWhitespace(n xmlNode) bool {
+	data, ok := n.(xml.CharData)
+	return ok && len(bytes.TrimSpace(data)) == 0
+}
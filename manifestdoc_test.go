@@ -0,0 +1,503 @@
+package winres
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// language=manifest
+const thirdPartyManifest = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<!-- Third party manifest -->
+<asmv1:assembly xmlns:asmv1="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0" xmlns:asmv3="urn:schemas-microsoft-com:asm.v3">
+  <asmv1:assemblyIdentity type="win32" name="Third.Party" version="1.0.0.0"/>
+  <file name="plugin.dll">
+    <comClass clsid="{00000000-0000-0000-0000-000000000001}" threadingModel="Apartment"/>
+  </file>
+  <msix xmlns="urn:schemas-microsoft-com:msix.v1" publisher="CN=Me" packageName="App" applicationId="App"/>
+  <asmv3:application>
+    <asmv3:windowsSettings xmlns:ws="http://schemas.microsoft.com/SMI/2016/WindowsSettings">
+      <ws:longPathAware>true</ws:longPathAware>
+    </asmv3:windowsSettings>
+  </asmv3:application>
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="asInvoker" uiAccess="false"></requestedExecutionLevel>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+</asmv1:assembly>
+`
+
+func TestManifestDocumentFromXML(t *testing.T) {
+	doc, err := ManifestDocumentFromXML([]byte(thirdPartyManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := AppManifestFromXML([]byte(thirdPartyManifest))
+	if !reflect.DeepEqual(doc.AppManifest, m) {
+		t.Error("fields should be read as in AppManifestFromXML")
+	}
+	if string(doc.Bytes()) != thirdPartyManifest {
+		t.Errorf("the manifest should be unchanged:\n%s", doc.Bytes())
+	}
+}
+
+func TestManifestDocument_Bytes(t *testing.T) {
+	doc, err := ManifestDocumentFromXML([]byte(thirdPartyManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc.Description = "A & B"
+	doc.Identity.Version = [4]uint16{1, 2, 3, 4}
+	doc.DPIAwareness = DPIPerMonitorV2
+	doc.LongPathAware = false
+	doc.GDIScaling = true
+	doc.ExecutionLevel = RequireAdministrator
+	doc.UseCommonControlsV6 = true
+	doc.Compatibility = Win10AndAbove
+
+	// language=manifest
+	expected := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<!-- Third party manifest -->
+<asmv1:assembly xmlns:asmv1="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0" xmlns:asmv3="urn:schemas-microsoft-com:asm.v3">
+  <asmv1:assemblyIdentity type="win32" name="Third.Party" version="1.2.3.4" processorArchitecture="*"/>
+  <asmv1:description>A &amp; B</asmv1:description>
+  <file name="plugin.dll">
+    <comClass clsid="{00000000-0000-0000-0000-000000000001}" threadingModel="Apartment"/>
+  </file>
+  <msix xmlns="urn:schemas-microsoft-com:msix.v1" publisher="CN=Me" packageName="App" applicationId="App"/>
+  <asmv3:application>
+    <asmv3:windowsSettings xmlns:ws="http://schemas.microsoft.com/SMI/2016/WindowsSettings">
+      <dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true</dpiAware>
+      <dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">permonitorv2,system</dpiAwareness>
+      <gdiScaling xmlns="http://schemas.microsoft.com/SMI/2017/WindowsSettings">true</gdiScaling>
+    </asmv3:windowsSettings>
+  </asmv3:application>
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="requireAdministrator" uiAccess="false"></requestedExecutionLevel>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+    </application>
+  </compatibility>
+  <asmv1:dependency>
+    <asmv1:dependentAssembly>
+      <asmv1:assemblyIdentity type="win32" name="Microsoft.Windows.Common-Controls" version="6.0.0.0" processorArchitecture="*" publicKeyToken="6595b64144ccf1df" language="*"/>
+    </asmv1:dependentAssembly>
+  </asmv1:dependency>
+</asmv1:assembly>
+`
+	data := doc.Bytes()
+	if string(data) != expected {
+		t.Errorf("*** got:\n%s###\n*** want:\n%s###", data, expected)
+	}
+	m, err := AppManifestFromXML(data)
+	if err != nil || !reflect.DeepEqual(m, doc.AppManifest) {
+		t.Error("the manifest should match the fields", err)
+	}
+
+	// Elements are removed along with their indentation
+	doc.UseCommonControlsV6 = false
+	doc.Identity.Name = ""
+	doc.GDIScaling = false
+	doc.Description = ""
+	expected = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<!-- Third party manifest -->
+<asmv1:assembly xmlns:asmv1="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0" xmlns:asmv3="urn:schemas-microsoft-com:asm.v3">
+  <file name="plugin.dll">
+    <comClass clsid="{00000000-0000-0000-0000-000000000001}" threadingModel="Apartment"/>
+  </file>
+  <msix xmlns="urn:schemas-microsoft-com:msix.v1" publisher="CN=Me" packageName="App" applicationId="App"/>
+  <asmv3:application>
+    <asmv3:windowsSettings xmlns:ws="http://schemas.microsoft.com/SMI/2016/WindowsSettings">
+      <dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true</dpiAware>
+      <dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">permonitorv2,system</dpiAwareness>
+    </asmv3:windowsSettings>
+  </asmv3:application>
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="requireAdministrator" uiAccess="false"></requestedExecutionLevel>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+    </application>
+  </compatibility>
+</asmv1:assembly>
+`
+	if data = doc.Bytes(); string(data) != expected {
+		t.Errorf("*** got:\n%s###\n*** want:\n%s###", data, expected)
+	}
+}
+
+func TestManifestDocument_Bytes_Empty(t *testing.T) {
+	doc, err := ManifestDocumentFromXML([]byte(`<assembly xmlns="urn:schemas-microsoft-com:asm.v1"/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.AppManifest = AppManifest{
+		Identity:            AssemblyIdentity{Name: "app"},
+		Description:         "desc",
+		AutoElevate:         true,
+		SegmentHeap:         true,
+		UIAccess:            true,
+		Compatibility:       Win81AndAbove,
+		UseCommonControlsV6: true,
+	}
+
+	// language=manifest
+	expected := `<assembly xmlns="urn:schemas-microsoft-com:asm.v1">
+  <assemblyIdentity type="win32" name="app" version="0.0.0.0" processorArchitecture="*"/>
+  <description>desc</description>
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+      <supportedOS Id="{1f676c76-80e1-4239-95bb-83d0f6d0da78}"/>
+    </application>
+  </compatibility>
+  <application xmlns="urn:schemas-microsoft-com:asm.v3">
+    <windowsSettings>
+      <dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true</dpiAware>
+      <dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">system</dpiAwareness>
+      <autoElevate xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true</autoElevate>
+      <heapType xmlns="http://schemas.microsoft.com/SMI/2020/WindowsSettings">SegmentHeap</heapType>
+    </windowsSettings>
+  </application>
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="asInvoker" uiAccess="true"/>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Microsoft.Windows.Common-Controls" version="6.0.0.0" processorArchitecture="*" publicKeyToken="6595b64144ccf1df" language="*"/>
+    </dependentAssembly>
+  </dependency>
+</assembly>`
+	data := doc.Bytes()
+	if string(data) != expected {
+		t.Errorf("*** got:\n%s###\n*** want:\n%s###", data, expected)
+	}
+	m, err := AppManifestFromXML(data)
+	if err != nil || !reflect.DeepEqual(m, doc.AppManifest) {
+		t.Error("the manifest should match the fields", err)
+	}
+}
+
+func TestManifestDocumentFromXML_Err(t *testing.T) {
+	for _, data := range []string{
+		``,
+		`<assembly>`,
+		`<assembly></application>`,
+		`<assembly><a></b></assembly>`,
+	} {
+		doc, err := ManifestDocumentFromXML([]byte(data))
+		if doc != nil || err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
+
+func TestResourceSet_SetManifestDocument(t *testing.T) {
+	doc, err := ManifestDocumentFromXML([]byte(thirdPartyManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.LongPathAware = false
+
+	rs := ResourceSet{}
+	rs.SetManifestDocument(doc)
+	data := rs.Get(RT_MANIFEST, ID(1), LCIDDefault)
+	if !bytes.Contains(data, []byte("<msix ")) || bytes.Contains(data, []byte("longPathAware")) {
+		t.Errorf("unexpected manifest:\n%s", data)
+	}
+}
+
+func TestManifestDocument_Bytes_Files(t *testing.T) {
+	doc, err := ManifestDocumentFromXML([]byte(thirdPartyManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Files) != 1 || len(doc.Files[0].COMClasses) != 1 || doc.Files[0].COMClasses[0].ThreadingModel != "Apartment" {
+		t.Fatal("the <file> element should be read", doc.Files)
+	}
+
+	doc.Files[0].WindowClasses = []WindowClass{{Name: "PluginWindow"}}
+	doc.Files = append(doc.Files, ManifestFile{
+		Name:     "server.dll",
+		TypeLibs: []TypeLib{{TLBID: "{22222222-2222-2222-2222-222222222222}", Version: "1.0"}},
+	})
+	doc.ExternalProxyStubs = []COMInterface{{IID: "{44444444-4444-4444-4444-444444444444}", NumMethods: 7}}
+
+	// language=manifest
+	expected := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<!-- Third party manifest -->
+<asmv1:assembly xmlns:asmv1="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0" xmlns:asmv3="urn:schemas-microsoft-com:asm.v3">
+  <asmv1:assemblyIdentity type="win32" name="Third.Party" version="1.0.0.0"/>
+  <asmv1:file name="plugin.dll">
+    <asmv1:comClass clsid="{00000000-0000-0000-0000-000000000001}" threadingModel="Apartment"/>
+    <asmv1:windowClass>PluginWindow</asmv1:windowClass>
+  </asmv1:file>
+  <asmv1:file name="server.dll">
+    <asmv1:typelib tlbid="{22222222-2222-2222-2222-222222222222}" version="1.0" helpdir=""/>
+  </asmv1:file>
+  <msix xmlns="urn:schemas-microsoft-com:msix.v1" publisher="CN=Me" packageName="App" applicationId="App"/>
+  <asmv3:application>
+    <asmv3:windowsSettings xmlns:ws="http://schemas.microsoft.com/SMI/2016/WindowsSettings">
+      <ws:longPathAware>true</ws:longPathAware>
+    </asmv3:windowsSettings>
+  </asmv3:application>
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="asInvoker" uiAccess="false"></requestedExecutionLevel>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+  <asmv1:comInterfaceExternalProxyStub iid="{44444444-4444-4444-4444-444444444444}" numMethods="7"/>
+</asmv1:assembly>
+`
+	data := doc.Bytes()
+	if string(data) != expected {
+		t.Errorf("*** got:\n%s###\n*** want:\n%s###", data, expected)
+	}
+	m, err := AppManifestFromXML(data)
+	if err != nil || !reflect.DeepEqual(m, doc.AppManifest) {
+		t.Error("the manifest should match the fields", err)
+	}
+}
+
+func TestManifestDocument_Bytes_Dependencies(t *testing.T) {
+	// language=manifest
+	manifest := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+  <assemblyIdentity type="win32" name="App" version="1.0.0.0" processorArchitecture="x86" publicKeyToken="0123456789abcdef"/>
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Microsoft.Windows.Common-Controls" version="6.0.0.0" processorArchitecture="*" publicKeyToken="6595b64144ccf1df" language="*"/>
+    </dependentAssembly>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Old.Lib" version="1.0.0.0" processorArchitecture="x86"/>
+    </dependentAssembly>
+  </dependency>
+  <dependency optional="yes">
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Other.Lib" version="2.0.0.0" processorArchitecture="x86"/>
+    </dependentAssembly>
+  </dependency>
+</assembly>
+`
+	doc, err := ManifestDocumentFromXML([]byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.UseCommonControlsV6 || len(doc.Dependencies) != 2 || doc.Dependencies[1].Name != "Other.Lib" {
+		t.Fatal("dependencies should be read", doc.Dependencies)
+	}
+
+	doc.Identity.Version = [4]uint16{2}
+	doc.Dependencies = []AssemblyIdentity{{Name: "New.Lib", Version: [4]uint16{3, 1}, Language: "en-US"}}
+
+	// language=manifest
+	expected := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+  <assemblyIdentity type="win32" name="App" version="2.0.0.0" processorArchitecture="x86" publicKeyToken="0123456789abcdef"/>
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="Microsoft.Windows.Common-Controls" version="6.0.0.0" processorArchitecture="*" publicKeyToken="6595b64144ccf1df" language="*"/>
+    </dependentAssembly>
+  </dependency>
+  <dependency>
+    <dependentAssembly>
+      <assemblyIdentity type="win32" name="New.Lib" version="3.1.0.0" processorArchitecture="*" language="en-US"/>
+    </dependentAssembly>
+  </dependency>
+</assembly>
+`
+	data := doc.Bytes()
+	if string(data) != expected {
+		t.Errorf("*** got:\n%s###\n*** want:\n%s###", data, expected)
+	}
+
+	doc.UseCommonControlsV6 = false
+	doc.Dependencies = nil
+	// language=manifest
+	expected = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+  <assemblyIdentity type="win32" name="App" version="2.0.0.0" processorArchitecture="x86" publicKeyToken="0123456789abcdef"/>
+</assembly>
+`
+	data = doc.Bytes()
+	if string(data) != expected {
+		t.Errorf("*** got:\n%s###\n*** want:\n%s###", data, expected)
+	}
+}
+
+func TestManifestDocument_Bytes_ModernSettings(t *testing.T) {
+	doc, err := ManifestDocumentFromXML([]byte(thirdPartyManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc.DPIAwareness = DPIPerMonitorV2
+	doc.DPIAwarenessFallback = []DPIAwareness{DPIPerMonitor}
+	doc.ActiveCodePage = CodePageUTF8
+	doc.SupportedArchitectures = []string{"amd64", "arm64"}
+
+	// language=manifest
+	expected := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<!-- Third party manifest -->
+<asmv1:assembly xmlns:asmv1="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0" xmlns:asmv3="urn:schemas-microsoft-com:asm.v3">
+  <asmv1:assemblyIdentity type="win32" name="Third.Party" version="1.0.0.0"/>
+  <file name="plugin.dll">
+    <comClass clsid="{00000000-0000-0000-0000-000000000001}" threadingModel="Apartment"/>
+  </file>
+  <msix xmlns="urn:schemas-microsoft-com:msix.v1" publisher="CN=Me" packageName="App" applicationId="App"/>
+  <asmv3:application>
+    <asmv3:windowsSettings xmlns:ws="http://schemas.microsoft.com/SMI/2016/WindowsSettings">
+      <ws:longPathAware>true</ws:longPathAware>
+      <dpiAware xmlns="http://schemas.microsoft.com/SMI/2005/WindowsSettings">true</dpiAware>
+      <dpiAwareness xmlns="http://schemas.microsoft.com/SMI/2016/WindowsSettings">permonitorv2,permonitor</dpiAwareness>
+      <activeCodePage xmlns="http://schemas.microsoft.com/SMI/2019/WindowsSettings">UTF-8</activeCodePage>
+      <supportedArchitectures xmlns="http://schemas.microsoft.com/SMI/2024/WindowsSettings">amd64 arm64</supportedArchitectures>
+    </asmv3:windowsSettings>
+  </asmv3:application>
+  <trustInfo xmlns="urn:schemas-microsoft-com:asm.v3">
+    <security>
+      <requestedPrivileges>
+        <requestedExecutionLevel level="asInvoker" uiAccess="false"></requestedExecutionLevel>
+      </requestedPrivileges>
+    </security>
+  </trustInfo>
+</asmv1:assembly>
+`
+	data := doc.Bytes()
+	if string(data) != expected {
+		t.Errorf("*** got:\n%s###\n*** want:\n%s###", data, expected)
+	}
+	m, err := AppManifestFromXML(data)
+	if err != nil || !reflect.DeepEqual(m, doc.AppManifest) {
+		t.Error("the manifest should match the fields", err)
+	}
+}
+
+func TestManifestDocument_Bytes_InPlace(t *testing.T) {
+	doc, err := ManifestDocumentFromXML([]byte(thirdPartyManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc.Files[0].Name = "b.dll"
+	doc.Files[0].COMClasses[0].ThreadingModel = "Both"
+	data := doc.Bytes()
+	if !bytes.Contains(data, []byte(`name="b.dll"`)) || !bytes.Contains(data, []byte(`threadingModel="Both"`)) {
+		t.Errorf("files modified in place should be updated:\n%s", data)
+	}
+
+	doc.DPIAwareness = DPIPerMonitorV2
+	doc.DPIAwarenessFallback = []DPIAwareness{DPIPerMonitor}
+	doc.SupportedArchitectures = []string{"amd64"}
+	doc.Dependencies = []AssemblyIdentity{{Name: "Lib", Version: [4]uint16{1}}}
+	doc.SupportedOSList = []string{OSWin7}
+	doc.Bytes()
+
+	doc.Files[0].COMClasses[0].ThreadingModel = "Free"
+	doc.DPIAwarenessFallback[0] = DPIUnaware
+	doc.SupportedArchitectures[0] = "arm64"
+	doc.Dependencies[0].Name = "Other.Lib"
+	doc.SupportedOSList[0] = OSWin10
+	data = doc.Bytes()
+	for _, s := range []string{
+		`threadingModel="Free"`,
+		`permonitorv2,unaware`,
+		`>arm64<`,
+		`name="Other.Lib"`,
+		`Id="` + OSWin10 + `"`,
+	} {
+		if !bytes.Contains(data, []byte(s)) {
+			t.Errorf("slices modified in place should be updated (%s):\n%s", s, data)
+		}
+	}
+}
+
+func TestManifestDocument_Bytes_SupportedOSList(t *testing.T) {
+	// language=manifest
+	manifest := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <!-- Windows 10 -->
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+    </application>
+  </compatibility>
+</assembly>
+`
+	doc, err := ManifestDocumentFromXML([]byte(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Compatibility != Win10AndAbove || doc.SupportedOSList != nil {
+		t.Fatal("Win10AndAbove should be read", doc.Compatibility, doc.SupportedOSList)
+	}
+
+	doc.MaxVersionTested = "10.0.22000.0"
+	doc.SupportedOSList = []string{OSWin10, OSWin7}
+
+	// language=manifest
+	expected := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <!-- Windows 10 -->
+      <maxversiontested Id="10.0.22000.0"/>
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+      <supportedOS Id="{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"/>
+    </application>
+  </compatibility>
+</assembly>
+`
+	data := doc.Bytes()
+	if string(data) != expected {
+		t.Errorf("*** got:\n%s###\n*** want:\n%s###", data, expected)
+	}
+	doc.Compatibility = Win7AndAbove
+	m, err := AppManifestFromXML(data)
+	if err != nil || !reflect.DeepEqual(m, doc.AppManifest) {
+		t.Error("the manifest should match the fields", err)
+	}
+
+	doc.MaxVersionTested = ""
+	doc.SupportedOSList = nil
+	// language=manifest
+	expected = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<assembly xmlns="urn:schemas-microsoft-com:asm.v1" manifestVersion="1.0">
+  <compatibility xmlns="urn:schemas-microsoft-com:compatibility.v1">
+    <application>
+      <!-- Windows 10 -->
+      <supportedOS Id="{8e0f7a12-bfb3-4fe8-b9a5-48fd50a15a9a}"/>
+      <supportedOS Id="{1f676c76-80e1-4239-95bb-83d0f6d0da78}"/>
+      <supportedOS Id="{4a2f28e3-53b9-4441-ba9c-d69d4a4a6e38}"/>
+      <supportedOS Id="{35138b9a-5d96-4fbd-8e2d-a2440225f93a}"/>
+    </application>
+  </compatibility>
+</assembly>
+`
+	data = doc.Bytes()
+	if string(data) != expected {
+		t.Errorf("*** got:\n%s###\n*** want:\n%s###", data, expected)
+	}
+}
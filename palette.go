@@ -0,0 +1,228 @@
+package winres
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// quantize reduces the colors of an image to a palette of n colors, for a paletted DIB.
+//
+// The first color of the palette is black, and it is used for transparent pixels.
+// This is required by the AND mask: the screen is ANDed with the mask and then XORed with the image.
+// The other colors are chosen by the median cut algorithm.
+//
+// It returns the palette and the palette index of each pixel.
+func quantize(img *image.NRGBA, n int) ([]color.NRGBA, []uint8) {
+	var (
+		bounds = img.Bounds()
+		counts = make(map[color.NRGBA]int)
+	)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if c := img.NRGBAAt(x, y); isOpaque(c) {
+				counts[color.NRGBA{R: c.R, G: c.G, B: c.B, A: 0xFF}]++
+			}
+		}
+	}
+
+	colors := make([]colorCount, 0, len(counts))
+	for c, count := range counts {
+		colors = append(colors, colorCount{c, count})
+	}
+	// Map iteration is random, but the result should not be
+	sort.Slice(colors, func(i, j int) bool {
+		ci, cj := colors[i].c, colors[j].c
+		return ci.R < cj.R || ci.R == cj.R && (ci.G < cj.G || ci.G == cj.G && ci.B < cj.B)
+	})
+
+	palette := append([]color.NRGBA{{A: 0xFF}}, medianCut(colors, n-1)...)
+
+	var (
+		indexes = make([]uint8, 0, bounds.Dx()*bounds.Dy())
+		cache   = make(map[color.NRGBA]uint8)
+	)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			if !isOpaque(c) {
+				indexes = append(indexes, 0)
+				continue
+			}
+			c.A = 0xFF
+			i, ok := cache[c]
+			if !ok {
+				i = nearestColor(palette, c)
+				cache[c] = i
+			}
+			indexes = append(indexes, i)
+		}
+	}
+
+	return palette, indexes
+}
+
+// isOpaque tells if a pixel is visible when transparency can only be on or off.
+func isOpaque(c color.NRGBA) bool {
+	return c.A >= 0x80
+}
+
+type colorCount struct {
+	c     color.NRGBA
+	count int
+}
+
+// medianCut returns at most n colors that best represent a list of colors.
+func medianCut(colors []colorCount, n int) []color.NRGBA {
+	if len(colors) == 0 || n <= 0 {
+		return nil
+	}
+
+	boxes := [][]colorCount{colors}
+	for len(boxes) < n {
+		// Split the box that has the widest range on a single channel
+		var (
+			best     = -1
+			bestCh   = 0
+			bestSize = 0
+		)
+		for i, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			ch, size := widestChannel(b)
+			if size > bestSize {
+				best, bestCh, bestSize = i, ch, size
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		b := boxes[best]
+		sort.SliceStable(b, func(i, j int) bool {
+			return channel(b[i].c, bestCh) < channel(b[j].c, bestCh)
+		})
+		total := 0
+		for _, c := range b {
+			total += c.count
+		}
+		k, sum := 1, b[0].count
+		for k < len(b)-1 && sum*2 < total {
+			sum += b[k].count
+			k++
+		}
+		boxes[best] = b[:k]
+		boxes = append(boxes, b[k:])
+	}
+
+	palette := make([]color.NRGBA, len(boxes))
+	for i, b := range boxes {
+		var r, g, bl, total int
+		for _, c := range b {
+			r += int(c.c.R) * c.count
+			g += int(c.c.G) * c.count
+			bl += int(c.c.B) * c.count
+			total += c.count
+		}
+		palette[i] = color.NRGBA{
+			R: uint8((r + total/2) / total),
+			G: uint8((g + total/2) / total),
+			B: uint8((bl + total/2) / total),
+			A: 0xFF,
+		}
+	}
+
+	return palette
+}
+
+// widestChannel returns the channel (0 for red, 1 for green, 2 for blue) with the widest range of values, and that range.
+func widestChannel(colors []colorCount) (int, int) {
+	var (
+		min = [3]int{0xFF, 0xFF, 0xFF}
+		max = [3]int{}
+	)
+	for _, c := range colors {
+		for ch := 0; ch < 3; ch++ {
+			v := int(channel(c.c, ch))
+			if v < min[ch] {
+				min[ch] = v
+			}
+			if v > max[ch] {
+				max[ch] = v
+			}
+		}
+	}
+
+	best := 0
+	for ch := 1; ch < 3; ch++ {
+		if max[ch]-min[ch] > max[best]-min[best] {
+			best = ch
+		}
+	}
+	return best, max[best] - min[best] + 1
+}
+
+func channel(c color.NRGBA, ch int) uint8 {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
+
+// nearestColor returns the index of the palette color closest to c.
+func nearestColor(palette []color.NRGBA, c color.NRGBA) uint8 {
+	var (
+		best     = 0
+		bestDist = -1
+	)
+	for i, p := range palette {
+		dr, dg, db := int(p.R)-int(c.R), int(p.G)-int(c.G), int(p.B)-int(c.B)
+		if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return uint8(best)
+}
+
+// toPaletted returns a lossless paletted copy of an image, or nil when the image has more than 256 colors,
+// or more than 8 bits per channel.
+//
+// Fully transparent pixels are considered identical, whatever their color.
+func toPaletted(img image.Image) *image.Paletted {
+	switch img.(type) {
+	case *image.NRGBA64, *image.RGBA64, *image.Gray16:
+		// Palette colors only have 8 bits per channel
+		return nil
+	}
+
+	var (
+		bounds  = img.Bounds()
+		palette = make(color.Palette, 0, 256)
+		indexes = make(map[color.NRGBA]uint8)
+		dst     = image.NewPaletted(bounds, nil)
+	)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				c = color.NRGBA{}
+			}
+			i, ok := indexes[c]
+			if !ok {
+				if len(palette) == 256 {
+					return nil
+				}
+				i = uint8(len(palette))
+				indexes[c] = i
+				palette = append(palette, c)
+			}
+			dst.SetColorIndex(x, y, i)
+		}
+	}
+	dst.Palette = palette
+	return dst
+}
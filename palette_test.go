@@ -0,0 +1,110 @@
+package winres
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestQuantize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 16), G: uint8(y * 16), B: 0x80, A: 0xFF})
+		}
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{R: 0xFF, A: 0x7F})
+
+	palette, indexes := quantize(img, 16)
+	if len(palette) != 16 || len(indexes) != 256 {
+		t.Fatal("unexpected lengths", len(palette), len(indexes))
+	}
+	if palette[0] != (color.NRGBA{A: 0xFF}) || indexes[0] != 0 {
+		t.Error("transparent pixels should use black, the first color")
+	}
+
+	// Every pixel should be close to its palette color
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if x == 0 && y == 0 {
+				continue
+			}
+			c, p := img.NRGBAAt(x, y), palette[indexes[y*16+x]]
+			if abs(int(c.R)-int(p.R)) > 64 || abs(int(c.G)-int(p.G)) > 64 || c.B != p.B {
+				t.Fatalf("pixel (%d, %d) is %v, palette color is %v", x, y, c, p)
+			}
+		}
+	}
+
+	// The result must be deterministic
+	palette2, indexes2 := quantize(img, 16)
+	if !reflect.DeepEqual(palette, palette2) || !reflect.DeepEqual(indexes, indexes2) {
+		t.Error("quantize is not deterministic")
+	}
+}
+
+func TestQuantize_FewColors(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	colors := []color.NRGBA{
+		{R: 0xFF, A: 0xFF},
+		{G: 0xFF, A: 0xFF},
+		{B: 0xFF, A: 0xFF},
+	}
+	for i := range img.Pix {
+		img.Pix[i] = 0
+	}
+	for i := 0; i < 16; i++ {
+		img.SetNRGBA(i%4, i/4, colors[i%3])
+	}
+
+	palette, indexes := quantize(img, 256)
+	if len(palette) != 4 {
+		t.Fatal("expected 4 colors, got", len(palette))
+	}
+	for i := 0; i < 16; i++ {
+		if palette[indexes[i]] != colors[i%3] {
+			t.Fatal("colors should be exact")
+		}
+	}
+}
+
+func TestToPaletted(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	img.SetNRGBA(1, 2, color.NRGBA{R: 0xFF, A: 0x80})
+	img.SetNRGBA(2, 3, color.NRGBA{G: 0xFF, A: 0})
+
+	p := toPaletted(img)
+	if p == nil || len(p.Palette) != 2 {
+		t.Fatal("expected 2 colors")
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if c := color.NRGBAModel.Convert(p.At(x, y)); c != img.At(x, y) && img.NRGBAAt(x, y).A != 0 {
+				t.Fatalf("pixel (%d, %d) is %v, expected %v", x, y, c, img.At(x, y))
+			}
+		}
+	}
+}
+
+func TestToPaletted_16Bits(t *testing.T) {
+	gray := image.NewGray16(image.Rect(0, 0, 4, 4))
+	gray.SetGray16(1, 1, color.Gray16{Y: 0x1234})
+	nrgba := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	nrgba.SetNRGBA64(1, 1, color.NRGBA64{R: 0x1234, A: 0xFFFF})
+	rgba := image.NewRGBA64(image.Rect(0, 0, 4, 4))
+	rgba.SetRGBA64(1, 1, color.RGBA64{R: 0x1234, A: 0xFFFF})
+
+	for _, img := range []image.Image{gray, nrgba, rgba} {
+		if toPaletted(img) != nil {
+			t.Errorf("%T: 16 bits images should not be paletted", img)
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -3,8 +3,10 @@ package winres
 import (
 	"bytes"
 	"debug/pe"
+	"encoding/binary"
 	"errors"
 	"io"
+	"sort"
 
 	"github.com/tc-hib/winres/version"
 )
@@ -156,6 +158,99 @@ func (rs *ResourceSet) WalkType(typeID Identifier, f func(resID Identifier, lang
 	}
 }
 
+// PruneOrphans removes the RT_ICON and RT_CURSOR resources that are not referenced
+// by any RT_GROUP_ICON or RT_GROUP_CURSOR resource, and returns their identifiers.
+//
+// Replacing an icon or a cursor leaves its former images in the set, unless PruneReplacedImages is used.
+func (rs *ResourceSet) PruneOrphans() (icons []Identifier, cursors []Identifier) {
+	icons = rs.pruneImages(RT_ICON, RT_GROUP_ICON, nil)
+	cursors = rs.pruneImages(RT_CURSOR, RT_GROUP_CURSOR, nil)
+	return icons, cursors
+}
+
+type resourceOptions struct {
+	pruneReplaced bool
+}
+
+type resourceOption func(opt *resourceOptions)
+
+// PruneReplacedImages makes SetIcon and SetCursor remove the images of the group they replace,
+// unless other groups still use them.
+func PruneReplacedImages() resourceOption {
+	return func(opt *resourceOptions) {
+		opt.pruneReplaced = true
+	}
+}
+
+func makeResourceOptions(opt []resourceOption) resourceOptions {
+	options := resourceOptions{}
+	for _, o := range opt {
+		o(&options)
+	}
+	return options
+}
+
+// pruneImages removes images of type typeID that are not referenced by any group of type groupTypeID.
+//
+// If candidates is not nil, only those images may be removed.
+// It returns the identifiers of removed images, in ascending order.
+func (rs *ResourceSet) pruneImages(typeID, groupTypeID Identifier, candidates []uint16) []Identifier {
+	te := rs.types[typeID]
+	if te == nil {
+		return nil
+	}
+
+	referenced := make(map[Identifier]bool)
+	rs.WalkType(groupTypeID, func(resID Identifier, langID uint16, data []byte) bool {
+		for _, id := range groupImageIDs(data) {
+			referenced[ID(id)] = true
+		}
+		return true
+	})
+
+	var keys []Identifier
+	if candidates != nil {
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+		for _, id := range candidates {
+			keys = append(keys, ID(id))
+		}
+	} else {
+		te.order()
+		keys = te.orderedKeys
+	}
+
+	var removed []Identifier
+	for _, k := range keys {
+		re := te.resources[k]
+		if referenced[k] || re == nil {
+			continue
+		}
+		removed = append(removed, k)
+		for langID := range re.data {
+			rs.delete(typeID, k, uint16(langID))
+		}
+	}
+
+	return removed
+}
+
+// groupImageIDs returns the image IDs listed in an RT_GROUP_ICON or RT_GROUP_CURSOR resource.
+//
+// Both have a 6 bytes header followed by 14 bytes entries that end with the ID.
+func groupImageIDs(data []byte) []uint16 {
+	if len(data) < 6 {
+		return nil
+	}
+	var (
+		count = int(binary.LittleEndian.Uint16(data[4:]))
+		ids   = make([]uint16, 0, count)
+	)
+	for i := 0; i < count && 6+i*14+14 <= len(data); i++ {
+		ids = append(ids, binary.LittleEndian.Uint16(data[6+i*14+12:]))
+	}
+	return ids
+}
+
 // Get returns resource data.
 //
 // Returns nil if the resource was not found.
@@ -334,16 +429,90 @@ func (rs *ResourceSet) bytes() ([]byte, []int) {
 //
 //  ForceCheckSum()         // Forces updating the checksum even when it was not set in the original file
 //  WithAuthenticode(<how>) // Allows updating the .rsrc section despite the file being signed
+//  WithOverlay(<how>)      // Keeps (default), removes, or refuses data appended after the last section
+//  ReclaimOldRSRC()        // Removes "old.rsrc" sections left when the .rsrc section had to be relocated
 //
 func (rs *ResourceSet) WriteToEXE(dst io.Writer, src io.ReadSeeker, opt ...exeOption) error {
-	data, reloc := rs.bytes()
-	options := exeOptions{}
-	for _, o := range opt {
-		o(&options)
+	options := makeEXEOptions(opt)
+	if options.deleteExisting {
+		return errors.New(errDeleteExisting)
 	}
+	return rs.writeToEXE(dst, src, options)
+}
+
+func (rs *ResourceSet) writeToEXE(dst io.Writer, src io.ReadSeeker, options exeOptions) error {
+	data, reloc := rs.bytes()
 	return replaceRSRCSection(dst, src, data, reloc, options)
 }
 
+// PatchEXEFile patches an executable file in place, to replace its resources with this ResourceSet.
+//
+// The new executable is first written to a temporary file in the same directory,
+// which then atomically replaces the original file, keeping its mode.
+// The original file is left untouched when an error occurs.
+//
+// It accepts the same options as WriteToEXE.
+func (rs *ResourceSet) PatchEXEFile(path string, opt ...exeOption) error {
+	return patchFile(path, func(dst io.Writer, src io.ReadSeeker) error {
+		return rs.WriteToEXE(dst, src, opt...)
+	})
+}
+
+// UpdateEXE patches an executable to modify some of its resources.
+//
+// It loads the resources of src, passes them to the update function, and then writes the new file to dst.
+// This is similar to calling BeginUpdateResource, UpdateResource and EndUpdateResource with the Win32 API.
+//
+// Resources that are not modified by the update function are kept as is.
+// If update returns an error, nothing is written to dst and UpdateEXE returns that error.
+//
+// src and dst should not point to a same file/buffer.
+//
+// It accepts the same options as WriteToEXE, plus:
+//
+//  DeleteExistingResources() // Starts from an empty ResourceSet instead of loading the existing resources
+//
+func UpdateEXE(dst io.Writer, src io.ReadSeeker, update func(rs *ResourceSet) error, opt ...exeOption) error {
+	options := makeEXEOptions(opt)
+	rs, err := loadForUpdate(src, options)
+	if err != nil {
+		return err
+	}
+	if err = update(rs); err != nil {
+		return err
+	}
+	return rs.writeToEXE(dst, src, options)
+}
+
+// UpdateEXEFile is like UpdateEXE, but it patches an executable file in place, as PatchEXEFile does.
+func UpdateEXEFile(path string, update func(rs *ResourceSet) error, opt ...exeOption) error {
+	return patchFile(path, func(dst io.Writer, src io.ReadSeeker) error {
+		return UpdateEXE(dst, src, update, opt...)
+	})
+}
+
+// CompactEXE rewrites an executable without the stale "old.rsrc" sections left by earlier patches.
+//
+// Resources are kept as is. This is like calling UpdateEXE with ReclaimOldRSRC and no modification.
+//
+// src and dst should not point to a same file/buffer.
+//
+// It accepts the same options as UpdateEXE.
+func CompactEXE(dst io.Writer, src io.ReadSeeker, opt ...exeOption) error {
+	return UpdateEXE(dst, src, func(*ResourceSet) error { return nil }, append(opt, ReclaimOldRSRC())...)
+}
+
+func loadForUpdate(src io.ReadSeeker, options exeOptions) (*ResourceSet, error) {
+	if options.deleteExisting {
+		return &ResourceSet{}, nil
+	}
+	rs, err := LoadFromEXE(src)
+	if err != nil && err != ErrNoResources {
+		return nil, err
+	}
+	return rs, nil
+}
+
 // IsSignedEXE helps knowing if an exe file is signed before encountering an error with WriteToEXE.
 func IsSignedEXE(exe io.ReadSeeker) (bool, error) {
 	pos, _ := exe.Seek(0, io.SeekCurrent)
@@ -355,3 +524,33 @@ func IsSignedEXE(exe io.ReadSeeker) (bool, error) {
 	}
 	return len(h.dirs) > pe.IMAGE_DIRECTORY_ENTRY_SECURITY && h.dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].VirtualAddress > 0, nil
 }
+
+// EXEOverlay locates data appended after the last section of an executable, such as a self-extractor payload.
+//
+// It returns the offset and the size of that data. The certificate table of a signed executable is not included.
+// The size is zero when the executable has no overlay.
+func EXEOverlay(exe io.ReadSeeker) (int64, int64, error) {
+	pos, _ := exe.Seek(0, io.SeekCurrent)
+	defer exe.Seek(pos, io.SeekStart)
+
+	exe.Seek(0, io.SeekStart)
+	pew := peWriter{}
+	pew.src.r = exe
+	pew.src.fileSize = getSeekerSize(exe)
+
+	var err error
+	pew.h, err = readPEHeaders(exe)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(pew.h.dirs) > pe.IMAGE_DIRECTORY_ENTRY_SECURITY {
+		pew.src.certOffset = int64(pew.h.dirs[pe.IMAGE_DIRECTORY_ENTRY_SECURITY].VirtualAddress)
+	}
+	err = pew.fillSectionsInfo()
+	if err != nil {
+		return 0, 0, err
+	}
+	pew.findOverlay()
+
+	return pew.src.overlayOffset, pew.src.overlayEnd - pew.src.overlayOffset, nil
+}
@@ -2,13 +2,17 @@ package winres
 
 import (
 	"bytes"
+	"debug/pe"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -110,7 +114,7 @@ func TestWinRes1(t *testing.T) {
 	r.SetIconTranslation(ID(1), 1033, icon2)
 	r.SetIconTranslation(ID(1), 1036, icon3)
 	r.SetIconTranslation(Name("SUPERB ICON"), 0, icon4)
-	r.SetIcon(ID(2), icon2)
+	r.SetIcon(ID(2), icon2) // Shares the RT_ICON images of the 1033 translation of ID(1)
 	r.SetCursor(ID(1), cursor)
 	v := version.Info{
 		ProductVersion: [4]uint16{5, 6, 7, 8},
@@ -1060,3 +1064,781 @@ func (ws *writeSeeker) Seek(off int64, whence int) (int64, error) {
 func (ws writeSeeker) Bytes() []byte {
 	return ws.buf.Bytes()
 }
+
+func TestResourceSet_WriteToEXE_Overlay(t *testing.T) {
+	overlay := append([]byte("PK\x03\x04"), testSectionData(0x123, 7)...)
+	exe := makeTestEXE([]testSection{
+		{name: ".text", data: testSectionData(0x300, 1)},
+		{name: ".data", data: testSectionData(0x100, 2)},
+	}, overlay)
+
+	off, size, err := EXEOverlay(bytes.NewReader(exe))
+	if err != nil || off != int64(len(exe)-len(overlay)) || size != int64(len(overlay)) {
+		t.Fatal(off, size, err)
+	}
+
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("data"))
+
+	for _, handling := range []overlayHandling{KeepOverlay, RemoveOverlay, ErrorIfOverlay} {
+		buf := bytes.Buffer{}
+		err = rs.WriteToEXE(&buf, bytes.NewReader(exe), WithOverlay(handling))
+		if handling == ErrorIfOverlay {
+			if err != ErrOverlay {
+				t.Fatal("expected error:\n", ErrOverlay, "\ngot:\n", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := buf.Bytes()
+		off, size, err = EXEOverlay(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if handling == KeepOverlay && (size != int64(len(overlay)) || !bytes.HasSuffix(out, overlay)) {
+			t.Error("overlay should have been kept")
+		}
+		if handling == RemoveOverlay && (size != 0 || off != int64(len(out))) {
+			t.Error("overlay should have been removed")
+		}
+		if !bytes.Equal(sectionData(t, out, ".data")[:0x100], testSectionData(0x100, 2)) {
+			t.Error("section data was modified")
+		}
+
+		// Patch again, this time with .rsrc being the last section
+		rs2, err := LoadFromEXE(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs2.Set(RT_RCDATA, ID(2), 0, make([]byte, 0x1000))
+		buf2 := bytes.Buffer{}
+		err = rs2.WriteToEXE(&buf2, bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, size2, _ := EXEOverlay(bytes.NewReader(buf2.Bytes()))
+		if size2 != size || !bytes.HasSuffix(buf2.Bytes(), out[off:off+size]) {
+			t.Error("overlay was not preserved on a second patch")
+		}
+	}
+}
+
+func TestResourceSet_WriteToEXE_OverlayNone(t *testing.T) {
+	exe := makeTestEXE([]testSection{{name: ".text", data: testSectionData(0x300, 1)}}, nil)
+
+	off, size, err := EXEOverlay(bytes.NewReader(exe))
+	if err != nil || off != int64(len(exe)) || size != 0 {
+		t.Fatal(off, size, err)
+	}
+
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("data"))
+	err = rs.WriteToEXE(io.Discard, bytes.NewReader(exe), WithOverlay(ErrorIfOverlay))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResourceSet_WriteToEXE_OverlaySigned(t *testing.T) {
+	overlay := testSectionData(0x80, 3)
+	cert := testSectionData(0x40, 4)
+	exe := makeTestEXE([]testSection{{name: ".text", data: testSectionData(0x300, 1)}}, append(overlay, cert...))
+	// Certificate table entry, which holds a file offset
+	binary.LittleEndian.PutUint32(exe[0xE8:], uint32(len(exe)-len(cert)))
+	binary.LittleEndian.PutUint32(exe[0xEC:], uint32(len(cert)))
+
+	_, size, err := EXEOverlay(bytes.NewReader(exe))
+	if err != nil || size != int64(len(overlay)) {
+		t.Fatal(size, err)
+	}
+
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("data"))
+
+	buf := bytes.Buffer{}
+	err = rs.WriteToEXE(&buf, bytes.NewReader(exe), WithAuthenticode(IgnoreSignature), WithOverlay(RemoveOverlay))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+	certOffset := binary.LittleEndian.Uint32(out[0xE8:])
+	if !bytes.HasSuffix(out, cert) || int(certOffset) != len(out)-len(cert) {
+		t.Error("certificate table was not preserved")
+	}
+	if _, size, _ = EXEOverlay(bytes.NewReader(out)); size != 0 {
+		t.Error("overlay should have been removed")
+	}
+
+	buf.Reset()
+	err = rs.WriteToEXE(&buf, bytes.NewReader(exe), WithAuthenticode(RemoveSignature))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = buf.Bytes()
+	if !bytes.HasSuffix(out, overlay) || binary.LittleEndian.Uint32(out[0xE8:]) != 0 {
+		t.Error("expected overlay without certificate table")
+	}
+}
+
+func TestEXEOverlay_Error(t *testing.T) {
+	r := bytes.NewReader([]byte{'N', 'Z', 0x40: 0})
+	r.Seek(2, io.SeekStart)
+	_, _, err := EXEOverlay(r)
+	if err == nil || err.Error() != errNotPEImage {
+		t.Fatal("expected error:\n", errNotPEImage, "\ngot:\n", err)
+	}
+	p, _ := r.Seek(0, io.SeekCurrent)
+	if p != 2 {
+		t.Fatal("expected EXEOverlay to restore reader's position, but it didn't")
+	}
+}
+
+func TestResourceSet_PatchEXEFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.exe")
+	exe := makeTestEXE([]testSection{{name: ".text", data: testSectionData(0x300, 1)}}, []byte("overlay"))
+	if err := os.WriteFile(path, exe, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("data"))
+	err := rs.PatchEXEFile(path, WithOverlay(RemoveOverlay))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Mode().Perm() != 0750 {
+		t.Errorf("expected mode %v, got %v", os.FileMode(0750), stat.Mode().Perm())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	loaded, err := LoadFromEXE(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(loaded.Get(RT_RCDATA, ID(1), 0)) != "data" {
+		t.Error("resource not found in patched file")
+	}
+	if _, size, _ := EXEOverlay(f); size != 0 {
+		t.Error("options were not applied")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Error("temporary file was not removed")
+	}
+}
+
+func TestResourceSet_PatchEXEFile_Symlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app.exe")
+	link := filepath.Join(dir, "link.exe")
+	exe := makeTestEXE([]testSection{{name: ".text", data: testSectionData(0x300, 1)}}, nil)
+	if err := os.WriteFile(target, exe, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("app.exe", link); err != nil {
+		t.Skip("cannot create a symbolic link:", err)
+	}
+
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("data"))
+	if err := rs.PatchEXEFile(link); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Lstat(link)
+	if err != nil || stat.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("the symbolic link was replaced", err)
+	}
+	b, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFromEXE(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(loaded.Get(RT_RCDATA, ID(1), 0)) != "data" {
+		t.Error("the target file was not patched")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Error("temporary file was not removed")
+	}
+}
+
+func TestResourceSet_PatchEXEFile_Err(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.exe")
+	exe := makeTestEXE([]testSection{{name: ".text", data: testSectionData(0x300, 1)}}, []byte("overlay"))
+	if err := os.WriteFile(path, exe, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("data"))
+	err := rs.PatchEXEFile(path, WithOverlay(ErrorIfOverlay))
+	if err != ErrOverlay {
+		t.Fatal("expected error:\n", ErrOverlay, "\ngot:\n", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil || !bytes.Equal(b, exe) {
+		t.Error("original file was modified")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Error("temporary file was not removed")
+	}
+
+	err = rs.PatchEXEFile(filepath.Join(dir, "missing.exe"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Error("expected a not exist error, got", err)
+	}
+}
+
+func TestUpdateEXE(t *testing.T) {
+	exe := makeTestEXE([]testSection{{name: ".text", data: testSectionData(0x300, 1)}}, nil)
+
+	// No resources yet
+	buf := bytes.Buffer{}
+	err := UpdateEXE(&buf, bytes.NewReader(exe), func(rs *ResourceSet) error {
+		if rs.Count() != 0 {
+			t.Error("expected an empty resource set")
+		}
+		rs.Set(RT_RCDATA, ID(1), 0, []byte("one"))
+		rs.Set(RT_RCDATA, ID(2), 0, []byte("two"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exe = append([]byte{}, buf.Bytes()...)
+
+	// Replace a single resource
+	buf.Reset()
+	err = UpdateEXE(&buf, bytes.NewReader(exe), func(rs *ResourceSet) error {
+		return rs.Set(RT_RCDATA, ID(2), 0, []byte("deux"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := LoadFromEXE(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Count() != 2 || string(rs.Get(RT_RCDATA, ID(1), 0)) != "one" || string(rs.Get(RT_RCDATA, ID(2), 0)) != "deux" {
+		t.Error("unexpected resources after update")
+	}
+
+	// Delete existing resources
+	buf.Reset()
+	err = UpdateEXE(&buf, bytes.NewReader(exe), func(rs *ResourceSet) error {
+		if rs.Count() != 0 {
+			t.Error("expected an empty resource set")
+		}
+		return rs.Set(RT_RCDATA, ID(3), 0, []byte("three"))
+	}, DeleteExistingResources())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err = LoadFromEXE(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Count() != 1 || string(rs.Get(RT_RCDATA, ID(3), 0)) != "three" {
+		t.Error("unexpected resources after update")
+	}
+}
+
+func TestUpdateEXE_Err(t *testing.T) {
+	exe := makeTestEXE([]testSection{{name: ".text", data: testSectionData(0x300, 1)}}, nil)
+
+	buf := bytes.Buffer{}
+	err := UpdateEXE(&buf, bytes.NewReader(exe), func(rs *ResourceSet) error {
+		return errors.New("oops")
+	})
+	if err == nil || err.Error() != "oops" || buf.Len() != 0 {
+		t.Error("expected update error, got", err)
+	}
+
+	err = UpdateEXE(&buf, bytes.NewReader([]byte{'N', 'Z', 0x40: 0}), func(rs *ResourceSet) error {
+		t.Error("update should not be called")
+		return nil
+	})
+	if err == nil || err.Error() != errNotPEImage {
+		t.Error("expected error:\n", errNotPEImage, "\ngot:\n", err)
+	}
+}
+
+func TestResourceSet_WriteToEXE_DeleteExistingResources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.exe")
+	exe := makeTestEXE([]testSection{{name: ".text", data: testSectionData(0x300, 1)}}, nil)
+	if err := os.WriteFile(path, exe, 0666); err != nil {
+		t.Fatal(err)
+	}
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("one"))
+
+	buf := bytes.Buffer{}
+	err := rs.WriteToEXE(&buf, bytes.NewReader(exe), DeleteExistingResources())
+	if err == nil || err.Error() != errDeleteExisting || buf.Len() != 0 {
+		t.Error("expected error:\n", errDeleteExisting, "\ngot:\n", err)
+	}
+
+	err = rs.PatchEXEFile(path, DeleteExistingResources())
+	if err == nil || err.Error() != errDeleteExisting {
+		t.Error("expected error:\n", errDeleteExisting, "\ngot:\n", err)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, exe) {
+		t.Error("the file should be left untouched")
+	}
+}
+
+func TestUpdateEXEFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.exe")
+	exe := makeTestEXE([]testSection{{name: ".text", data: testSectionData(0x300, 1)}}, nil)
+	if err := os.WriteFile(path, exe, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		err := UpdateEXEFile(path, func(rs *ResourceSet) error {
+			return rs.Set(RT_RCDATA, ID(i), 0, []byte{byte(i)})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, _ := os.ReadFile(path)
+	rs, err := LoadFromEXE(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Count() != 2 {
+		t.Error("expected 2 resources, got", rs.Count())
+	}
+}
+
+func TestResourceSet_WriteToEXE_FixedSections(t *testing.T) {
+	exe := makeTestEXE([]testSection{
+		{name: ".text", data: testSectionData(0x300, 1)},
+		{name: ".rsrc", data: testSectionData(0x100, 2), dir: pe.IMAGE_DIRECTORY_ENTRY_RESOURCE},
+		{name: ".tls", data: testSectionData(0x80, 3), dir: pe.IMAGE_DIRECTORY_ENTRY_TLS},
+	}, nil)
+
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, make([]byte, 0x3000))
+
+	buf := bytes.Buffer{}
+	err := rs.WriteToEXE(&buf, bytes.NewReader(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+
+	f, err := pe.NewFile(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range f.Sections {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != ".text,old.rsrc,.tls,.rsrc" {
+		t.Fatal("unexpected sections:", names)
+	}
+	if old := f.Section("old.rsrc"); old.Size != 0 || old.Offset != 0 || old.VirtualAddress != 0x2000 {
+		t.Error("old .rsrc section should be an empty placeholder")
+	}
+	if old := f.Section("old.rsrc"); old.Characteristics != pe.IMAGE_SCN_MEM_READ|pe.IMAGE_SCN_CNT_UNINITIALIZED_DATA {
+		t.Errorf("old .rsrc section should be readable uninitialized data, got characteristics %#x", old.Characteristics)
+	}
+	if tls := f.Section(".tls"); tls.VirtualAddress != 0x3000 || tls.Offset != 0x800 {
+		t.Error("unexpected .tls section:", tls.SectionHeader)
+	}
+	if !bytes.Equal(sectionData(t, out, ".tls")[:0x80], testSectionData(0x80, 3)) {
+		t.Error("section data was modified")
+	}
+	if f.Section(".rsrc").VirtualAddress != 0x4000 {
+		t.Error("new .rsrc section should follow the last section")
+	}
+	if len(out) != 0x400+0x400+0x200+0x3200 {
+		t.Error("old .rsrc data should have been removed from the file")
+	}
+
+	// Patch again, the new .rsrc section is the last one, it can grow in place
+	rs2, err := LoadFromEXE(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs2.Get(RT_RCDATA, ID(1), 0)) != 0x3000 {
+		t.Fatal("resource was not written")
+	}
+	rs2.Set(RT_RCDATA, ID(2), 0, make([]byte, 0x2000))
+	buf2 := bytes.Buffer{}
+	err = rs2.WriteToEXE(&buf2, bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := pe.NewFile(bytes.NewReader(buf2.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f2.Sections) != 4 || f2.Section(".rsrc").VirtualAddress != 0x4000 {
+		t.Error("the .rsrc section should have been updated in place")
+	}
+	if !bytes.Equal(sectionData(t, buf2.Bytes(), ".tls")[:0x80], testSectionData(0x80, 3)) {
+		t.Error("section data was modified")
+	}
+}
+
+func TestResourceSet_WriteToEXE_FixedSectionsFit(t *testing.T) {
+	// The raw size of .rsrc is smaller than its virtual size, which is enough for the new data
+	exe := makeTestEXE([]testSection{
+		{name: ".text", data: testSectionData(0x300, 1)},
+		{name: ".rsrc", virtSize: 0x1800, data: testSectionData(0x100, 2), dir: pe.IMAGE_DIRECTORY_ENTRY_RESOURCE},
+		{name: ".pdata", data: testSectionData(0x80, 3), dir: pe.IMAGE_DIRECTORY_ENTRY_EXCEPTION},
+	}, nil)
+
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, make([]byte, 0x1000))
+
+	buf := bytes.Buffer{}
+	err := rs.WriteToEXE(&buf, bytes.NewReader(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := pe.NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sections) != 3 {
+		t.Fatal("the .rsrc section should have been updated in place")
+	}
+	if s := f.Section(".rsrc"); s.VirtualSize != 0x1800 || s.Size != 0x1200 {
+		t.Error("unexpected .rsrc section:", s.SectionHeader)
+	}
+	if s := f.Section(".pdata"); s.VirtualAddress != 0x4000 || s.Offset != 0x1A00 {
+		t.Error("unexpected .pdata section:", s.SectionHeader)
+	}
+	if !bytes.Equal(sectionData(t, buf.Bytes(), ".pdata")[:0x80], testSectionData(0x80, 3)) {
+		t.Error("section data was modified")
+	}
+	if f.OptionalHeader.(*pe.OptionalHeader64).SizeOfImage != 0x5000 {
+		t.Error("wrong image size")
+	}
+}
+
+func TestCompactEXE(t *testing.T) {
+	// Layout left by an earlier patch, when .tls prevented the .rsrc section from growing
+	exe := makeTestEXE([]testSection{
+		{name: ".text", data: testSectionData(0x300, 1)},
+		{name: "old.rsrc", data: testSectionData(0x800, 2)},
+		{name: ".tls", data: testSectionData(0x80, 3), dir: pe.IMAGE_DIRECTORY_ENTRY_TLS},
+	}, nil)
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("data"))
+	// Too large for the address range of old.rsrc
+	rs.Set(RT_RCDATA, ID(2), 0, make([]byte, 0x1000))
+	buf := bytes.Buffer{}
+	if err := rs.WriteToEXE(&buf, bytes.NewReader(exe)); err != nil {
+		t.Fatal(err)
+	}
+	exe = buf.Bytes()
+
+	out := bytes.Buffer{}
+	err := CompactEXE(&out, bytes.NewReader(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := pe.NewFile(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sections) != 4 {
+		t.Fatal("old.rsrc should have been kept as a placeholder")
+	}
+	if old := f.Section("old.rsrc"); old.Size != 0 || old.Offset != 0 || old.VirtualAddress != 0x2000 {
+		t.Error("old.rsrc should be empty")
+	}
+	if out.Len() != len(exe)-0x800 {
+		t.Error("old.rsrc data should have been removed from the file")
+	}
+	if f.Section(".tls").VirtualAddress != 0x3000 || !bytes.Equal(sectionData(t, out.Bytes(), ".tls")[:0x80], testSectionData(0x80, 3)) {
+		t.Error(".tls section was modified")
+	}
+	rs2, err := LoadFromEXE(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rs2.Get(RT_RCDATA, ID(1), 0)) != "data" {
+		t.Error("resources were modified")
+	}
+}
+
+func TestCompactEXE_LastSection(t *testing.T) {
+	exe := makeTestEXE([]testSection{
+		{name: ".text", data: testSectionData(0x300, 1)},
+		{name: "old.rsrc", virtSize: 0x2800, data: testSectionData(0x800, 2)},
+	}, nil)
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("data"))
+	buf := bytes.Buffer{}
+	if err := rs.WriteToEXE(&buf, bytes.NewReader(exe)); err != nil {
+		t.Fatal(err)
+	}
+	exe = buf.Bytes()
+
+	out := bytes.Buffer{}
+	err := CompactEXE(&out, bytes.NewReader(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := pe.NewFile(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Sections) != 2 || f.Section(".rsrc").VirtualAddress != 0x2000 || f.Section(".rsrc").Offset != 0x800 {
+		t.Fatal("old.rsrc should have been removed")
+	}
+	if f.OptionalHeader.(*pe.OptionalHeader64).SizeOfImage != 0x3000 {
+		t.Error("wrong image size")
+	}
+	rs2, err := LoadFromEXE(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rs2.Get(RT_RCDATA, ID(1), 0)) != "data" {
+		t.Error("resources were modified")
+	}
+}
+
+func TestCompactEXE_MoveRSRCBack(t *testing.T) {
+	// old.rsrc cannot be removed because of .tls, but .rsrc is the last section and fits in old.rsrc
+	exe := makeTestEXE([]testSection{
+		{name: ".text", data: testSectionData(0x300, 1)},
+		{name: "old.rsrc", virtSize: 0x2000, data: testSectionData(0x100, 2)},
+		{name: ".tls", data: testSectionData(0x80, 3), dir: pe.IMAGE_DIRECTORY_ENTRY_TLS},
+		{name: ".pdata", data: testSectionData(0x80, 4), dir: pe.IMAGE_DIRECTORY_ENTRY_EXCEPTION},
+		{name: ".rsrc", data: testSectionData(0x100, 5), dir: pe.IMAGE_DIRECTORY_ENTRY_RESOURCE},
+	}, nil)
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, []byte("data"))
+	buf := bytes.Buffer{}
+	if err := rs.WriteToEXE(&buf, bytes.NewReader(exe)); err != nil {
+		t.Fatal(err)
+	}
+	exe = buf.Bytes()
+
+	out := bytes.Buffer{}
+	err := CompactEXE(&out, bytes.NewReader(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := pe.NewFile(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range f.Sections {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != ".text,.rsrc,.tls,.pdata" {
+		t.Fatal("unexpected sections:", names)
+	}
+	if s := f.Section(".rsrc"); s.VirtualAddress != 0x2000 || s.VirtualSize != 0x2000 || s.Offset != 0xC00 || s.Size != 0x200 {
+		t.Error("unexpected .rsrc section:", s.SectionHeader)
+	}
+	if s := f.Section(".rsrc"); s.Characteristics != pe.IMAGE_SCN_MEM_READ|pe.IMAGE_SCN_CNT_INITIALIZED_DATA {
+		t.Errorf("unexpected .rsrc characteristics %#x", s.Characteristics)
+	}
+	if f.Section(".tls").VirtualAddress != 0x4000 || !bytes.Equal(sectionData(t, out.Bytes(), ".tls")[:0x80], testSectionData(0x80, 3)) {
+		t.Error(".tls section was modified")
+	}
+	if f.Section(".pdata").VirtualAddress != 0x5000 || !bytes.Equal(sectionData(t, out.Bytes(), ".pdata")[:0x80], testSectionData(0x80, 4)) {
+		t.Error(".pdata section was modified")
+	}
+	if f.OptionalHeader.(*pe.OptionalHeader64).SizeOfImage != 0x6000 {
+		t.Error("wrong image size")
+	}
+	if out.Len() >= len(exe) {
+		t.Error("the file should be smaller")
+	}
+	rs2, err := LoadFromEXE(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rs2.Get(RT_RCDATA, ID(1), 0)) != "data" {
+		t.Error("resources were modified")
+	}
+}
+
+func TestResourceSet_WriteToEXE_ReclaimOldRSRC(t *testing.T) {
+	exe := makeTestEXE([]testSection{
+		{name: ".text", data: testSectionData(0x300, 1)},
+		{name: "old.rsrc", virtSize: 0x4000, data: testSectionData(0x100, 2)},
+		{name: ".tls", data: testSectionData(0x80, 3), dir: pe.IMAGE_DIRECTORY_ENTRY_TLS},
+		{name: ".rsrc", data: testSectionData(0x100, 4), dir: pe.IMAGE_DIRECTORY_ENTRY_RESOURCE},
+		{name: ".pdata", data: testSectionData(0x80, 5), dir: pe.IMAGE_DIRECTORY_ENTRY_EXCEPTION},
+	}, nil)
+
+	rs := ResourceSet{}
+	rs.Set(RT_RCDATA, ID(1), 0, make([]byte, 0x3000))
+
+	buf := bytes.Buffer{}
+	err := rs.WriteToEXE(&buf, bytes.NewReader(exe), ReclaimOldRSRC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+
+	f, err := pe.NewFile(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range f.Sections {
+		names = append(names, s.Name)
+	}
+	if strings.Join(names, ",") != ".text,.rsrc,.tls,old.rsrc,.pdata" {
+		t.Fatal("unexpected sections:", names)
+	}
+	if s := f.Section(".rsrc"); s.VirtualAddress != 0x2000 || s.VirtualSize != 0x4000 || s.Offset != 0xC00 {
+		t.Error("the old.rsrc section should have been reused:", s.SectionHeader)
+	}
+	if s := f.Section("old.rsrc"); s.VirtualAddress != 0x7000 || s.Size != 0 {
+		t.Error("unexpected old.rsrc section:", s.SectionHeader)
+	}
+	if !bytes.Equal(sectionData(t, out, ".tls")[:0x80], testSectionData(0x80, 3)) ||
+		!bytes.Equal(sectionData(t, out, ".pdata")[:0x80], testSectionData(0x80, 5)) {
+		t.Error("section data was modified")
+	}
+	if f.OptionalHeader.(*pe.OptionalHeader64).SizeOfImage != 0x9000 {
+		t.Error("wrong image size")
+	}
+	rs2, err := LoadFromEXE(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs2.Get(RT_RCDATA, ID(1), 0)) != 0x3000 {
+		t.Error("resource was not written")
+	}
+}
+
+func TestResourceSet_PruneOrphans(t *testing.T) {
+	newIcon := func(c uint8) *Icon {
+		img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+		img.Pix[0] = c
+		icon, err := NewIconFromResizedImage(img, []int{32, 16})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return icon
+	}
+	newCursor := func(c uint8) *Cursor {
+		img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+		img.Pix[0] = c
+		cursor, err := NewCursorFromImages([]CursorImage{{img, HotSpot{}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cursor
+	}
+
+	rs := ResourceSet{}
+	rs.SetIcon(ID(1), newIcon(1))
+	rs.SetIconTranslation(ID(1), 0x409, newIcon(2))
+	rs.SetIcon(ID(1), newIcon(3))
+	rs.SetCursor(ID(1), newCursor(1))
+	rs.SetCursor(ID(1), newCursor(2))
+	rs.Set(RT_ICON, Name("ORPHAN"), 0x409, []byte{1})
+	rs.Set(RT_ICON, ID(42), 0x409, []byte{1})
+	rs.Set(RT_ICON, ID(42), 0x40C, []byte{2})
+
+	// The 16x16 image is shared by all three icons
+	icons, cursors := rs.PruneOrphans()
+	if fmt.Sprint(icons) != "[ORPHAN 1 42]" || fmt.Sprint(cursors) != "[1]" {
+		t.Fatal("unexpected orphans", icons, cursors)
+	}
+	var remaining []Identifier
+	rs.WalkType(RT_ICON, func(resID Identifier, langID uint16, data []byte) bool {
+		remaining = append(remaining, resID)
+		return true
+	})
+	if fmt.Sprint(remaining) != "[2 3 4]" || rs.Get(RT_CURSOR, ID(1), 0) != nil || rs.Get(RT_CURSOR, ID(2), 0) == nil {
+		t.Error("unexpected remaining images", remaining)
+	}
+	for _, langID := range []uint16{0, 0x409} {
+		if _, err := rs.GetIconTranslation(ID(1), langID); err != nil {
+			t.Error(err)
+		}
+	}
+
+	icons, cursors = rs.PruneOrphans()
+	if icons != nil || cursors != nil {
+		t.Error("there should be no more orphans")
+	}
+
+	rs.SetCursor(ID(1), newCursor(3))
+	rs.Set(RT_GROUP_CURSOR, ID(1), 0, nil)
+	if _, cursors = rs.PruneOrphans(); len(cursors) != 2 || rs.types[RT_CURSOR] != nil {
+		t.Error("every cursor image should be pruned", cursors)
+	}
+}
+
+func TestResourceSet_SetIcon_PruneReplacedImages(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	icon1, _ := NewIconFromResizedImage(img, []int{32, 16})
+	img.Pix[0] = 1
+	icon2, _ := NewIconFromResizedImage(img, []int{32, 16})
+	img.Pix[0] = 2
+	icon3, _ := NewIconFromResizedImage(img, []int{32, 16})
+
+	rs := ResourceSet{}
+	rs.SetIcon(ID(1), icon1)
+	rs.SetIcon(ID(2), icon2)
+	// Image 1 is only used by the first icon, image 2 is shared
+	if err := rs.SetIcon(ID(1), icon3, PruneReplacedImages()); err != nil {
+		t.Fatal(err)
+	}
+	var remaining []Identifier
+	rs.WalkType(RT_ICON, func(resID Identifier, langID uint16, data []byte) bool {
+		remaining = append(remaining, resID)
+		return true
+	})
+	if fmt.Sprint(remaining) != "[2 3 4]" {
+		t.Error("unexpected remaining images", remaining)
+	}
+
+	cursor1, _ := NewCursorFromImages([]CursorImage{{img, HotSpot{}}})
+	cursor2, _ := NewCursorFromImages([]CursorImage{{img, HotSpot{1, 1}}})
+	rs.SetCursorTranslation(ID(1), 0x409, cursor1)
+	if err := rs.SetCursorTranslation(ID(1), 0x409, cursor2, PruneReplacedImages()); err != nil {
+		t.Fatal(err)
+	}
+	if rs.Get(RT_CURSOR, ID(1), 0) != nil || rs.Get(RT_CURSOR, ID(2), 0) == nil {
+		t.Error("the former cursor image should be pruned")
+	}
+}